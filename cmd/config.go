@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"x509-watch/internal/certloader"
+	"x509-watch/internal/metrics"
+	"x509-watch/internal/rules"
+)
+
+// === Config file ===
+
+// fileConfig is the --config YAML file: any number of named sources.
+//
+//	sources:
+//	  - name: vault
+//	    type: dir
+//	    path: /vault/certs
+//	    interval: 1m
+//	    labels: {team: infra}
+//	    include: ["*.pem"]
+//	    watch: true
+//	  - name: ingress
+//	    type: tls
+//	    targets: [example.com:443]
+type fileConfig struct {
+	LogLevel string         `yaml:"log_level"` // overrides --log-level, applied on reload
+	Policy   policyConfig   `yaml:"policy"`
+	Rules    []ruleConfig   `yaml:"rules"`
+	Sources  []sourceConfig `yaml:"sources"`
+}
+
+// policyConfig tunes the weak crypto checks run on every certificate, see
+// certloader.Policy. Zero values keep the defaults.
+type policyConfig struct {
+	WeakSignatureHashes []string `yaml:"weak_signature_hashes"` // default MD2, MD5, SHA1
+	MinRSABits          int      `yaml:"min_rsa_bits"`          // default 2048
+	MinECBits           int      `yaml:"min_ec_bits"`           // default 256
+	MaxValidityDays     int      `yaml:"max_validity_days"`     // default 398
+	Disable             []string `yaml:"disable"`               // rule names
+}
+
+func (pc policyConfig) policy() *certloader.Policy {
+	p := certloader.DefaultPolicy()
+	if len(pc.WeakSignatureHashes) > 0 {
+		p.WeakHashes = pc.WeakSignatureHashes
+	}
+	if pc.MinRSABits > 0 {
+		p.MinRSABits = pc.MinRSABits
+	}
+	if pc.MinECBits > 0 {
+		p.MinECBits = pc.MinECBits
+	}
+	if pc.MaxValidityDays > 0 {
+		p.MaxValidity = time.Duration(pc.MaxValidityDays) * 24 * time.Hour
+	}
+	p.Disabled = pc.Disable
+	return p
+}
+
+func (pc policyConfig) validate() []error {
+	var errs []error
+	if pc.MinRSABits < 0 || pc.MinECBits < 0 || pc.MaxValidityDays < 0 {
+		errs = append(errs, errors.New("min_rsa_bits, min_ec_bits and max_validity_days must be greater or equal to 0"))
+	}
+	for _, rule := range pc.Disable {
+		if !slices.Contains(certloader.PolicyRules(), rule) {
+			errs = append(errs, fmt.Errorf("unknown rule %q (%s)", rule, strings.Join(certloader.PolicyRules(), ", ")))
+		}
+	}
+	for _, h := range pc.WeakSignatureHashes {
+		if strings.TrimSpace(h) == "" {
+			errs = append(errs, errors.New("weak_signature_hashes may not hold empty names"))
+		}
+	}
+	return errs
+}
+
+// ruleConfig is a user-defined rule evaluated on every certificate after each
+// scan, see rules.Rule.
+//
+//	rules:
+//	  - name: internal_short_lived
+//	    description: the internal CA issues for 90 days at most
+//	    when: cert.issuer == "Corp Internal CA"
+//	    expr: cert.lifetime <= duration("90d")
+type ruleConfig struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	When        string `yaml:"when"` // empty = every certificate
+	Expr        string `yaml:"expr"`
+}
+
+func (rc ruleConfig) rule() (*rules.Rule, error) {
+	return rules.New(rc.Name, rc.Description, rc.When, rc.Expr)
+}
+
+// ruleSet compiles the rules of a validated config.
+func (fc *fileConfig) ruleSet() []*rules.Rule {
+	set := make([]*rules.Rule, 0, len(fc.Rules))
+	for _, rc := range fc.Rules {
+		if r, err := rc.rule(); err == nil {
+			set = append(set, r)
+		}
+	}
+	return set
+}
+
+type sourceConfig struct {
+	Name     string            `yaml:"name"`
+	Type     string            `yaml:"type"` // file, dir, tls, crl, url, kubernetes, kubeconfig, vault
+	Path     string            `yaml:"path"`
+	Targets  []string          `yaml:"targets"`
+	URLs     []string          `yaml:"urls"`
+	StartTLS string            `yaml:"starttls"`
+	Timeout  time.Duration     `yaml:"timeout"`
+	Interval time.Duration     `yaml:"interval"` // 0 = inherit --interval
+	Labels   map[string]string `yaml:"labels"`
+	Include  []string          `yaml:"include"`
+	Exclude  []string          `yaml:"exclude"`
+	Workers  int               `yaml:"workers"`  // dir: files parsed concurrently, 0 = one per CPU
+	Watch    bool              `yaml:"watch"`    // rescan on filesystem events (file, dir)
+	Debounce time.Duration     `yaml:"debounce"` // quiet period before a watch rescan
+
+	VerifyChain bool   `yaml:"verify_chain"` // check every bundle chains to a trusted root
+	Roots       string `yaml:"roots"`        // trusted roots (PEM/DER), "" = inherit --roots
+
+	CheckRevocation bool `yaml:"check_revocation"` // OCSP and CRL lookups, answers shared by all sources
+
+	// PKCS#12 keystore passwords (file, dir), tried in this order
+	PasswordFile string   `yaml:"password_file"`
+	PasswordEnv  string   `yaml:"password_env"`
+	Passwords    []string `yaml:"passwords"`
+
+	// Certificates embedded in YAML, JSON or env files (file, dir)
+	Embedded      bool     `yaml:"embedded"`       // PEM blocks anywhere in the file
+	EmbeddedPaths []string `yaml:"embedded_paths"` // base64 DER at these document paths
+
+	PairKeys bool `yaml:"pair_keys"` // pair private keys with certificates (file, dir)
+
+	// Kubernetes secrets (and ConfigMaps) listed through the API
+	Namespace     string   `yaml:"namespace"`      // "" = all namespaces
+	LabelSelector string   `yaml:"label_selector"` // e.g. app=web
+	ConfigMaps    bool     `yaml:"configmaps"`     // list ConfigMaps too
+	Keys          []string `yaml:"keys"`           // decoded in addition to tls.crt and ca.crt
+	Kubeconfig    string   `yaml:"kubeconfig"`     // "" = in-cluster, or $KUBECONFIG / ~/.kube/config
+	Context       string   `yaml:"context"`        // kubeconfig context, "" = current
+
+	// Vault PKI secrets engines
+	Address string          `yaml:"address"` // "" = $VAULT_ADDR
+	Mounts  []string        `yaml:"mounts"`  // PKI mount paths
+	Auth    vaultAuthConfig `yaml:"auth"`
+	CACert  string          `yaml:"ca_cert"` // CA of the Vault server, "" = system pool
+}
+
+// vaultAuthConfig is the auth block of a vault source, see certloader.VaultAuth.
+type vaultAuthConfig struct {
+	Method       string `yaml:"method"` // token (default), approle or kubernetes
+	Mount        string `yaml:"mount"`  // "" = the method name
+	Token        string `yaml:"token"`
+	TokenFile    string `yaml:"token_file"`
+	RoleID       string `yaml:"role_id"`
+	SecretID     string `yaml:"secret_id"`
+	SecretIDFile string `yaml:"secret_id_file"`
+	Role         string `yaml:"role"`
+	JWTFile      string `yaml:"jwt_file"`
+}
+
+func (a vaultAuthConfig) auth() certloader.VaultAuth {
+	return certloader.VaultAuth{
+		Method: a.Method, Mount: a.Mount,
+		Token: a.Token, TokenFile: a.TokenFile,
+		RoleID: a.RoleID, SecretID: a.SecretID, SecretIDFile: a.SecretIDFile,
+		Role: a.Role, JWTFile: a.JWTFile,
+	}
+}
+
+// passwords returns the keystore password sources, nil when none is set.
+func (s sourceConfig) passwords() *certloader.Passwords {
+	if s.PasswordFile == "" && s.PasswordEnv == "" && len(s.Passwords) == 0 {
+		return nil
+	}
+	return &certloader.Passwords{File: s.PasswordFile, Env: s.PasswordEnv, List: s.Passwords}
+}
+
+const (
+	sourceTypeFile       = "file"
+	sourceTypeDir        = "dir"
+	sourceTypeTLS        = "tls"
+	sourceTypeCRL        = "crl"
+	sourceTypeURL        = "url"
+	sourceTypeKube       = "kubernetes"
+	sourceTypeKubeconfig = "kubeconfig"
+	sourceTypeVault      = "vault"
+)
+
+var (
+	sourceNameRe = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+	labelNameRe  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// Labels set by the exporter itself, not overridable from the config
+	reservedLabels = append([]string{
+		"common_name", "issuer", "filepath", "serial", "source", "reason", "method", "key_file", "rule", "state", certloader.AliasLabel,
+		certloader.NamespaceLabel, certloader.SecretLabel, certloader.ConfigMapLabel, certloader.KeyLabel,
+		certloader.ClusterLabel, certloader.UserLabel, certloader.ContextLabel, certloader.LocationLabel,
+		certloader.MountLabel,
+	}, metrics.CertInfoLabels...)
+)
+
+func loadFileConfig(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseFileConfig(data)
+}
+
+func parseFileConfig(data []byte) (*fileConfig, error) {
+	var fc fileConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&fc); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	if err := fc.validate(); err != nil {
+		return nil, err
+	}
+	return &fc, nil
+}
+
+// validate reports every problem at once, each prefixed by the offending source.
+func (fc *fileConfig) validate() error {
+	if len(fc.Sources) == 0 {
+		return fmt.Errorf("config: at least one source must be declared")
+	}
+
+	var errs []error
+	switch strings.ToLower(fc.LogLevel) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		errs = append(errs, fmt.Errorf("config: log_level must be one of: debug, info, warn, error"))
+	}
+	for _, err := range fc.Policy.validate() {
+		errs = append(errs, fmt.Errorf("config: policy: %w", err))
+	}
+	ruleNames := make(map[string]int)
+	for i, rc := range fc.Rules {
+		prefix := fmt.Sprintf("rules[%d]", i)
+		if rc.Name != "" {
+			prefix = fmt.Sprintf("rules[%d] (%s)", i, rc.Name)
+		}
+		switch {
+		case rc.Name == "":
+			errs = append(errs, fmt.Errorf("config: %s: name is required", prefix))
+		case !sourceNameRe.MatchString(rc.Name):
+			errs = append(errs, fmt.Errorf("config: %s: name %q may only contain letters, digits, '_', '-' and '.'", prefix, rc.Name))
+		}
+		if j, dup := ruleNames[rc.Name]; dup && rc.Name != "" {
+			errs = append(errs, fmt.Errorf("config: %s: name already used by rules[%d]", prefix, j))
+		}
+		ruleNames[rc.Name] = i
+		if _, err := rc.rule(); err != nil {
+			errs = append(errs, fmt.Errorf("config: %s: %w", prefix, err))
+		}
+	}
+
+	seen := make(map[string]int)
+	for i, src := range fc.Sources {
+		prefix := fmt.Sprintf("sources[%d]", i)
+		if src.Name != "" {
+			prefix = fmt.Sprintf("sources[%d] (%s)", i, src.Name)
+		}
+		for _, err := range src.validate() {
+			errs = append(errs, fmt.Errorf("config: %s: %w", prefix, err))
+		}
+		if j, dup := seen[src.Name]; dup && src.Name != "" {
+			errs = append(errs, fmt.Errorf("config: %s: name already used by sources[%d]", prefix, j))
+		}
+		seen[src.Name] = i
+	}
+	return errors.Join(errs...)
+}
+
+func (s sourceConfig) validate() []error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch {
+	case s.Name == "":
+		add("name is required")
+	case !sourceNameRe.MatchString(s.Name):
+		add("name %q may only contain letters, digits, '_', '-' and '.'", s.Name)
+	}
+
+	switch s.Type {
+	case sourceTypeFile, sourceTypeDir, sourceTypeCRL, sourceTypeKubeconfig:
+		if s.Path == "" {
+			add("path is required for type %s", s.Type)
+		}
+		if len(s.Targets) > 0 {
+			add("targets is not allowed for type %s", s.Type)
+		}
+		if s.StartTLS != "" {
+			add("starttls is only allowed for type tls")
+		}
+	case sourceTypeTLS:
+		if len(s.Targets) == 0 {
+			add("targets is required for type tls")
+		}
+		if s.Path != "" {
+			add("path is not allowed for type tls")
+		}
+		if s.StartTLS != "" && !slices.Contains(certloader.StartTLSProtocols(), s.StartTLS) {
+			add("starttls must be one of: %s", strings.Join(certloader.StartTLSProtocols(), ", "))
+		}
+	case sourceTypeURL:
+		if len(s.URLs) == 0 {
+			add("urls is required for type url")
+		}
+		if s.Path != "" || len(s.Targets) > 0 {
+			add("path and targets are not allowed for type url")
+		}
+		for _, u := range s.URLs {
+			if err := certloader.ValidateURL(u); err != nil {
+				add("%v", err)
+			}
+		}
+	case sourceTypeKube:
+		if s.Path != "" || len(s.Targets) > 0 {
+			add("path and targets are not allowed for type kubernetes")
+		}
+	case sourceTypeVault:
+		if len(s.Mounts) == 0 {
+			add("mounts is required for type vault")
+		}
+		if s.Path != "" || len(s.Targets) > 0 {
+			add("path and targets are not allowed for type vault")
+		}
+		switch s.Auth.Method {
+		case "", certloader.VaultAuthToken:
+		case certloader.VaultAuthAppRole:
+			if s.Auth.RoleID == "" || (s.Auth.SecretID == "" && s.Auth.SecretIDFile == "") {
+				add("auth method approle requires role_id and secret_id or secret_id_file")
+			}
+		case certloader.VaultAuthKubernetes:
+			if s.Auth.Role == "" {
+				add("auth method kubernetes requires role")
+			}
+		default:
+			add("auth method must be one of: token, approle, kubernetes")
+		}
+	case "":
+		add("type is required (file, dir, tls, crl, url, kubernetes, kubeconfig or vault)")
+	default:
+		add("unknown type %q (file, dir, tls, crl, url, kubernetes, kubeconfig or vault)", s.Type)
+	}
+	if s.Type != sourceTypeURL && len(s.URLs) > 0 {
+		add("urls is only allowed for type url")
+	}
+	if s.Type != sourceTypeVault && (s.Address != "" || len(s.Mounts) > 0 || s.Auth != (vaultAuthConfig{}) || s.CACert != "") {
+		add("address, mounts, auth and ca_cert are only allowed for type vault")
+	}
+	if s.Type != sourceTypeKube && (s.Namespace != "" || s.LabelSelector != "" || s.ConfigMaps ||
+		len(s.Keys) > 0 || s.Kubeconfig != "" || s.Context != "") {
+		add("namespace, label_selector, configmaps, keys, kubeconfig and context are only allowed for type kubernetes")
+	}
+
+	if s.Type != sourceTypeDir && (len(s.Include) > 0 || len(s.Exclude) > 0) {
+		add("include/exclude are only allowed for type dir")
+	}
+	if s.Type != sourceTypeDir && s.Workers != 0 {
+		add("workers is only allowed for type dir")
+	}
+	if s.Workers < 0 {
+		add("workers must be greater or equal to 0")
+	}
+	for _, pattern := range append(slices.Clone(s.Include), s.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			add("invalid pattern %q: %v", pattern, err)
+		}
+	}
+
+	if s.Watch && s.Type != sourceTypeFile && s.Type != sourceTypeDir {
+		add("watch is only allowed for types file and dir")
+	}
+	if s.Debounce < 0 {
+		add("debounce must be greater or equal to 0")
+	}
+
+	if s.Type != sourceTypeFile && s.Type != sourceTypeDir && s.passwords() != nil {
+		add("password_file, password_env and passwords are only allowed for types file and dir")
+	}
+	if s.Type != sourceTypeFile && s.Type != sourceTypeDir && s.Embedded {
+		add("embedded is only allowed for types file and dir")
+	}
+	if s.Type != sourceTypeFile && s.Type != sourceTypeDir && s.PairKeys {
+		add("pair_keys is only allowed for types file and dir")
+	}
+	if len(s.EmbeddedPaths) > 0 && !s.Embedded {
+		add("embedded_paths requires embedded")
+	}
+	for _, expr := range s.EmbeddedPaths {
+		if err := certloader.ValidateDocPath(expr); err != nil {
+			add("%v", err)
+		}
+	}
+	if s.Type == sourceTypeCRL && (s.VerifyChain || s.CheckRevocation) {
+		add("verify_chain and check_revocation are not allowed for type crl")
+	}
+	if s.Roots != "" && !s.VerifyChain {
+		add("roots requires verify_chain")
+	}
+
+	if s.Interval < 0 {
+		add("interval must be greater or equal to 0")
+	}
+	if s.Timeout < 0 {
+		add("timeout must be greater or equal to 0")
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(s.Labels)) {
+		switch {
+		case !labelNameRe.MatchString(name) || strings.HasPrefix(name, "__"):
+			add("invalid label name %q", name)
+		case slices.Contains(reservedLabels, name):
+			add("label %q is reserved", name)
+		}
+	}
+
+	return errs
+}
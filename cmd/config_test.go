@@ -0,0 +1,254 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFileConfig_Valid(t *testing.T) {
+	fc, err := parseFileConfig([]byte(`
+sources:
+  - name: vault
+    type: dir
+    path: /vault/certs
+    interval: 1m
+    labels:
+      team: infra
+    include: ["*.pem", "*.crt"]
+    exclude: ["old-*"]
+  - name: ingress
+    type: tls
+    targets: [example.com:443, mail.example.com]
+    starttls: smtp
+    timeout: 3s
+  - name: ca
+    type: file
+    path: /etc/ssl/ca.pem
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fc.Sources) != 3 {
+		t.Fatalf("expected 3 sources, got %d", len(fc.Sources))
+	}
+	if fc.Sources[0].Interval != time.Minute {
+		t.Errorf("expected interval=1m, got %s", fc.Sources[0].Interval)
+	}
+	if fc.Sources[0].Labels["team"] != "infra" {
+		t.Errorf("expected label team=infra, got %v", fc.Sources[0].Labels)
+	}
+	if fc.Sources[1].Timeout != 3*time.Second || len(fc.Sources[1].Targets) != 2 {
+		t.Errorf("unexpected tls source: %+v", fc.Sources[1])
+	}
+}
+
+func TestParseFileConfig_Policy(t *testing.T) {
+	fc, err := parseFileConfig([]byte(`
+policy:
+  min_rsa_bits: 3072
+  max_validity_days: 90
+  disable: [weak_signature]
+sources:
+  - {name: a, type: file, path: /x}
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p := fc.Policy.policy()
+	if p.MinRSABits != 3072 || p.MinECBits != 256 || p.MaxValidity != 90*24*time.Hour || len(p.WeakHashes) != 3 {
+		t.Errorf("unexpected policy %+v", p)
+	}
+	if len(p.Disabled) != 1 || p.Disabled[0] != "weak_signature" {
+		t.Errorf("expected weak_signature to be disabled, got %v", p.Disabled)
+	}
+}
+
+func TestParseFileConfig_Rules(t *testing.T) {
+	fc, err := parseFileConfig([]byte(`
+rules:
+  - name: corp_sans
+    description: SANs under corp.example
+    expr: cert.sans.all(s, s.endsWith(".corp.example"))
+  - name: no_prod_wildcards
+    when: cert.filepath.startsWith("/etc/prod/")
+    expr: '!cert.sans.exists(s, s.startsWith("*."))'
+sources:
+  - {name: a, type: file, path: /x}
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	set := fc.ruleSet()
+	if len(set) != 2 || set[0].Name != "corp_sans" || set[0].When != nil || set[1].When == nil {
+		t.Errorf("unexpected rules %+v", set)
+	}
+}
+
+func TestParseFileConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []string
+	}{
+		{"empty", `sources: []`, []string{"at least one source"}},
+		{"unknown field", "sources:\n  - name: a\n    type: dir\n    pth: /x\n", []string{"field pth not found"}},
+		{"missing name and type", "sources:\n  - path: /x\n", []string{
+			"sources[0]: name is required",
+			"sources[0]: type is required",
+		}},
+		{"duplicate name", "sources:\n  - {name: a, type: dir, path: /x}\n  - {name: a, type: dir, path: /y}\n", []string{
+			"sources[1] (a): name already used by sources[0]",
+		}},
+		{"dir without path", "sources:\n  - {name: a, type: dir, targets: [x:443]}\n", []string{
+			"sources[0] (a): path is required for type dir",
+			"sources[0] (a): targets is not allowed for type dir",
+		}},
+		{"tls without targets", "sources:\n  - {name: a, type: tls, starttls: gopher, include: ['*.pem']}\n", []string{
+			"targets is required for type tls",
+			"starttls must be one of",
+			"include/exclude are only allowed for type dir",
+		}},
+		{"bad labels", "sources:\n  - {name: a, type: file, path: /x, labels: {filepath: x, 1bad: y}}\n", []string{
+			`invalid label name "1bad"`,
+			`label "filepath" is reserved`,
+		}},
+		{"bad values", "sources:\n  - {name: a b, type: dir, path: /x, interval: -1s, exclude: ['[']}\n", []string{
+			`name "a b" may only contain`,
+			"interval must be greater or equal to 0",
+			`invalid pattern "["`,
+		}},
+		{"watch on tls", "sources:\n  - {name: a, type: tls, targets: [x:443], watch: true, debounce: -1s}\n", []string{
+			"watch is only allowed for types file and dir",
+			"debounce must be greater or equal to 0",
+		}},
+		{"bad workers", "sources:\n  - {name: a, type: dir, path: /x, workers: -2}\n  - {name: b, type: file, path: /y, workers: 2}\n", []string{
+			"sources[0] (a): workers must be greater or equal to 0",
+			"sources[1] (b): workers is only allowed for type dir",
+		}},
+		{"roots without verify_chain", "sources:\n  - {name: a, type: tls, targets: [x:443], roots: /ca.pem}\n", []string{
+			"sources[0] (a): roots requires verify_chain",
+		}},
+		{"crl source", "sources:\n  - {name: a, type: crl, targets: [x:443], verify_chain: true}\n", []string{
+			"sources[0] (a): path is required for type crl",
+			"sources[0] (a): targets is not allowed for type crl",
+			"sources[0] (a): verify_chain and check_revocation are not allowed for type crl",
+		}},
+		{"passwords on tls", "sources:\n  - {name: a, type: tls, targets: [x:443], password_file: /pw}\n", []string{
+			"sources[0] (a): password_file, password_env and passwords are only allowed for types file and dir",
+		}},
+		{"kubernetes fields", "sources:\n  - {name: a, type: kubernetes, path: /x, labels: {namespace: x}}\n  - {name: b, type: dir, path: /y, namespace: default}\n", []string{
+			"sources[0] (a): path and targets are not allowed for type kubernetes",
+			`sources[0] (a): label "namespace" is reserved`,
+			"sources[1] (b): namespace, label_selector, configmaps, keys, kubeconfig and context are only allowed for type kubernetes",
+		}},
+		{"kubeconfig without path", "sources:\n  - {name: a, type: kubeconfig, labels: {cluster: x}}\n", []string{
+			"sources[0] (a): path is required for type kubeconfig",
+			`sources[0] (a): label "cluster" is reserved`,
+		}},
+		{"embedded", "sources:\n  - {name: a, type: tls, targets: [x:443], embedded: true}\n  - {name: b, type: dir, path: /x, embedded_paths: ['a..b']}\n", []string{
+			"sources[0] (a): embedded is only allowed for types file and dir",
+			"sources[1] (b): embedded_paths requires embedded",
+			`sources[1] (b): invalid document path "a..b": empty key`,
+		}},
+		{"vault", "sources:\n  - {name: a, type: vault, path: /x, auth: {method: approle, role_id: r}, labels: {mount: x}}\n  - {name: b, type: vault, mounts: [pki], auth: {method: ldap}}\n  - {name: c, type: dir, path: /x, mounts: [pki]}\n", []string{
+			"sources[0] (a): mounts is required for type vault",
+			"sources[0] (a): path and targets are not allowed for type vault",
+			"sources[0] (a): auth method approle requires role_id and secret_id or secret_id_file",
+			`sources[0] (a): label "mount" is reserved`,
+			"sources[1] (b): auth method must be one of: token, approle, kubernetes",
+			"sources[2] (c): address, mounts, auth and ca_cert are only allowed for type vault",
+		}},
+		{"url", "sources:\n  - {name: a, type: url, path: /x}\n  - {name: b, type: url, urls: [pki.example.com/ca.pem]}\n  - {name: c, type: file, path: /x, urls: [https://pki/ca.pem]}\n", []string{
+			"sources[0] (a): urls is required for type url",
+			"sources[0] (a): path and targets are not allowed for type url",
+			`sources[1] (b): invalid url "pki.example.com/ca.pem"`,
+			"sources[2] (c): urls is only allowed for type url",
+		}},
+		{"pair_keys", "sources:\n  - {name: a, type: tls, targets: [x:443], pair_keys: true}\n", []string{
+			"sources[0] (a): pair_keys is only allowed for types file and dir",
+		}},
+		{"policy", "policy: {min_rsa_bits: -1, disable: [max_validity, sha1], weak_signature_hashes: ['']}\nsources:\n  - {name: a, type: file, path: /x, labels: {rule: x}}\n", []string{
+			"config: policy: min_rsa_bits, min_ec_bits and max_validity_days must be greater or equal to 0",
+			`config: policy: unknown rule "sha1" (ec_key_size, max_validity, rsa_key_size, weak_signature)`,
+			"config: policy: weak_signature_hashes may not hold empty names",
+			`sources[0] (a): label "rule" is reserved`,
+		}},
+		{"rules", "rules:\n  - {expr: 'true'}\n  - {name: a b, expr: 'cert.subject == \"x\"'}\n  - {name: c}\n  - {name: c, when: 'cert.is_ca &&', expr: 'true'}\nsources:\n  - {name: a, type: file, path: /x}\n", []string{
+			"config: rules[0]: name is required",
+			`config: rules[1] (a b): name "a b" may only contain letters, digits, '_', '-' and '.'`,
+			`config: rules[1] (a b): invalid expression "cert.subject == \"x\"": ERROR: <input>:1:1: undeclared reference to 'cert'`,
+			"config: rules[2] (c): expr is required",
+			"config: rules[3] (c): name already used by rules[2]",
+			`config: rules[3] (c): invalid expression "cert.is_ca &&": ERROR: <input>:1:14: Syntax error: mismatched input '<EOF>'`,
+		}},
+		{"unknown type", "sources:\n  - {name: a, type: ftp}\n", []string{`unknown type "ftp"`}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseFileConfig([]byte(tc.yaml))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error to contain %q, got:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigSources_FromFlags(t *testing.T) {
+	cfg := config{certDir: "/certs"}
+	fc, err := cfg.load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	scs := fc.Sources
+	if len(scs) != 1 || scs[0].Type != sourceTypeDir || scs[0].Path != "/certs" || scs[0].Name != "" {
+		t.Fatalf("unexpected sources: %+v", scs)
+	}
+
+	if fc, _ := (config{}).load(); len(fc.Sources) != 0 {
+		t.Fatalf("expected no source without flags, got %+v", fc.Sources)
+	}
+}
+
+func TestConfigSources_FromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("sources:\n  - {name: a, type: dir, path: /x}\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	fc, err := config{configFile: path}.load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fc.Sources) != 1 || fc.Sources[0].Name != "a" {
+		t.Fatalf("unexpected sources: %+v", fc.Sources)
+	}
+}
+
+func TestConfigValidate_ConfigWithSourceFlags(t *testing.T) {
+	cfg := config{configFile: "x.yml", certDir: "/certs", tlsTimeout: time.Second, logLevel: "info"}
+	if err := cfg.validate(); err == nil {
+		t.Fatal("expected --config and --cert-dir to be mutually exclusive")
+	}
+
+	// Per-source flags would be silently ignored
+	for name, set := range map[string]func(*config){
+		"workers":          func(c *config) { c.workers = 4 },
+		"verify-chain":     func(c *config) { c.verifyChain = true },
+		"check-revocation": func(c *config) { c.revocation = true },
+	} {
+		cfg := config{configFile: "x.yml", tlsTimeout: time.Second, revocationTimeout: time.Second, logLevel: "info"}
+		set(&cfg)
+		if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "--"+name) {
+			t.Errorf("expected --%s to be rejected with --config, got %v", name, err)
+		}
+	}
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -16,6 +20,7 @@ import (
 
 	"x509-watch/internal/certloader"
 	"x509-watch/internal/metrics"
+	"x509-watch/internal/rules"
 )
 
 var (
@@ -23,20 +28,46 @@ var (
 	revision = "unknown"
 )
 
-// loader is the common interface for FileLoader and DirLoader.
+// loader is the common interface for FileLoader, DirLoader and TLSLoader.
 type loader interface {
 	LoadCertificates(ctx context.Context) ([]*certloader.CertInfo, []*certloader.CertError)
 }
 
+// crlLoader is implemented by CRLLoader.
+type crlLoader interface {
+	LoadCRLs(ctx context.Context) ([]*certloader.CRLInfo, []*certloader.CertError)
+}
+
+// watcher is implemented by loaders able to rescan on filesystem events (FileLoader, DirLoader).
+type watcher interface {
+	Watch(ctx context.Context, debounce time.Duration, onChange certloader.OnChange) error
+}
+
 // === Config ===
 
 type config struct {
-	listenAddr     string
-	certFile       string
-	certDir        string
-	scanInterval   time.Duration
-	logLevel       string
-	perCertMetrics bool
+	listenAddr        string
+	configFile        string
+	certFile          string
+	certDir           string
+	tlsTargets        []string
+	tlsTimeout        time.Duration
+	startTLS          string
+	watch             bool
+	workers           int
+	scanCache         bool
+	scanCacheFile     string
+	verifyChain       bool
+	roots             string
+	revocation        bool
+	revocationTimeout time.Duration
+	scanInterval      time.Duration
+	logLevel          string
+	perCertMetrics    bool
+	probeRoots        []string
+
+	cache   *certloader.ScanCache         // built from scanCache/scanCacheFile, shared by dir sources
+	revoker *certloader.RevocationChecker // shared by sources with check_revocation
 }
 
 func parseFlags() config {
@@ -49,15 +80,45 @@ func parseFlags() config {
 		fmt.Println()
 		fmt.Fprintf(flag.CommandLine.Output(), `Examples:
 	%s --cert-file=/path/to/cert.pem
-	%s --cert-dir=/etc/vault/certs --interval=1m --log-level=debug `, os.Args[0], os.Args[0])
+	%s --cert-dir=/etc/vault/certs --interval=1m --log-level=debug
+	%s --tls-targets=example.com:443,mail.example.com:993 --interval=5m
+	%s --tls-targets=mail.example.com --starttls=smtp
+	%s --config=/etc/x509-watch/config.yml `, os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
 	}
 
 	flag.StringVar(&cfg.listenAddr, "listen", ":9101", "HTTP listen address (host:port)")
+	flag.StringVar(&cfg.configFile, "config", "", "Path to a YAML file declaring multiple sources (replaces --cert-file, --cert-dir and --tls-targets)")
 	flag.StringVar(&cfg.certFile, "cert-file", "", "Path to a certificate file (PEM/DER)")
 	flag.StringVar(&cfg.certDir, "cert-dir", "", "Path to a directory containing certificates")
+	flag.Func("tls-targets", "Comma-separated list of TLS endpoints to probe (host:port, port defaults to 443)", func(v string) error {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				cfg.tlsTargets = append(cfg.tlsTargets, t)
+			}
+		}
+		return nil
+	})
+	flag.DurationVar(&cfg.tlsTimeout, "tls-timeout", 5*time.Second, "Dial and handshake timeout per TLS target")
+	flag.StringVar(&cfg.startTLS, "starttls", "", "Protocol upgrade before the TLS handshake: "+strings.Join(certloader.StartTLSProtocols(), ", "))
+	flag.BoolVar(&cfg.watch, "watch", false, "Rescan --cert-file/--cert-dir on filesystem (inotify) events, on top of --interval")
+	flag.IntVar(&cfg.workers, "workers", 0, "Files parsed concurrently by --cert-dir (0 = one per CPU)")
+	flag.BoolVar(&cfg.scanCache, "scan-cache", true, "Skip unchanged files (same mtime, size and inode) when rescanning directories")
+	flag.StringVar(&cfg.scanCacheFile, "scan-cache-file", "", "Persist the scan cache to this file, so that restarts skip unchanged files too")
+	flag.BoolVar(&cfg.verifyChain, "verify-chain", false, "Check that every file or endpoint chain leads to a trusted root (x509_cert_chain_valid)")
+	flag.StringVar(&cfg.roots, "roots", "", "Trusted roots bundle (PEM/DER) for chain verification instead of the system pool")
+	flag.BoolVar(&cfg.revocation, "check-revocation", false, "Look certificates up in their OCSP responders and CRL distribution points (x509_cert_revoked)")
+	flag.DurationVar(&cfg.revocationTimeout, "revocation-timeout", 10*time.Second, "HTTP timeout per OCSP or CRL request")
 	flag.DurationVar(&cfg.scanInterval, "interval", 0, "Scan interval (0 = only once at startup)")
 	flag.StringVar(&cfg.logLevel, "log-level", "info", "Log level: debug, info, warn, error")
 	flag.BoolVar(&cfg.perCertMetrics, "per-cert-metrics", true, "Expose per-certificate metrics (disable for high cardinality environments)")
+	flag.Func("probe-roots", "Comma-separated directories the file and dir /probe modules may read below (both modules are disabled when empty)", func(v string) error {
+		for _, r := range strings.Split(v, ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				cfg.probeRoots = append(cfg.probeRoots, r)
+			}
+		}
+		return nil
+	})
 	flag.BoolVar(&showHelp, "help", false, "Show help and exit")
 	flag.BoolVar(&showHelp, "h", false, "Show help and exit (shorthand)")
 
@@ -72,11 +133,35 @@ func parseFlags() config {
 }
 
 func (c config) validate() error {
+	sources := 0
+	for _, set := range []bool{c.certFile != "", c.certDir != "", len(c.tlsTargets) > 0} {
+		if set {
+			sources++
+		}
+	}
 	switch {
-	case c.certFile == "" && c.certDir == "":
-		return fmt.Errorf("either --cert-file or --cert-dir must be set")
-	case c.certFile != "" && c.certDir != "":
-		return fmt.Errorf("only one of --cert-file or --cert-dir can be set")
+	case c.configFile != "" && sources > 0:
+		return fmt.Errorf("--config cannot be combined with --cert-file, --cert-dir or --tls-targets")
+	case c.configFile != "" && (c.workers != 0 || c.verifyChain || c.revocation):
+		return fmt.Errorf("--workers, --verify-chain and --check-revocation cannot be combined with --config, set workers, verify_chain or check_revocation on its sources")
+	case sources > 1:
+		return fmt.Errorf("only one of --cert-file, --cert-dir or --tls-targets can be set")
+	case c.tlsTimeout <= 0:
+		return fmt.Errorf("tls-timeout must be greater than 0")
+	case c.watch && c.certFile == "" && c.certDir == "":
+		return fmt.Errorf("--watch requires --cert-file or --cert-dir")
+	case c.startTLS != "" && len(c.tlsTargets) == 0:
+		return fmt.Errorf("--starttls requires --tls-targets")
+	case c.startTLS != "" && !slices.Contains(certloader.StartTLSProtocols(), c.startTLS):
+		return fmt.Errorf("starttls must be one of: %s", strings.Join(certloader.StartTLSProtocols(), ", "))
+	case c.workers < 0:
+		return fmt.Errorf("workers must be greater or equal to 0")
+	case c.scanCacheFile != "" && !c.scanCache:
+		return fmt.Errorf("--scan-cache-file requires --scan-cache")
+	case c.roots != "" && !c.verifyChain && c.configFile == "":
+		return fmt.Errorf("--roots requires --verify-chain")
+	case c.revocationTimeout <= 0:
+		return fmt.Errorf("revocation-timeout must be greater than 0")
 	case c.scanInterval < 0:
 		return fmt.Errorf("interval must be greater or equal to 0")
 	}
@@ -88,6 +173,32 @@ func (c config) validate() error {
 	return nil
 }
 
+// load returns the --config file, or the single source described by the
+// command line flags (unnamed, so no "source" label).
+func (c config) load() (*fileConfig, error) {
+	if c.configFile != "" {
+		return loadFileConfig(c.configFile)
+	}
+
+	switch {
+	case c.certFile != "":
+		return &fileConfig{Sources: []sourceConfig{{Type: sourceTypeFile, Path: c.certFile, Watch: c.watch, VerifyChain: c.verifyChain, CheckRevocation: c.revocation}}}, nil
+	case c.certDir != "":
+		return &fileConfig{Sources: []sourceConfig{{Type: sourceTypeDir, Path: c.certDir, Watch: c.watch, Workers: c.workers, VerifyChain: c.verifyChain, CheckRevocation: c.revocation}}}, nil
+	case len(c.tlsTargets) > 0:
+		return &fileConfig{Sources: []sourceConfig{{Type: sourceTypeTLS, Targets: c.tlsTargets, StartTLS: c.startTLS, VerifyChain: c.verifyChain, CheckRevocation: c.revocation}}}, nil
+	}
+	return &fileConfig{}, nil
+}
+
+// logLevelFor returns the level from the config file, falling back to --log-level.
+func (c config) logLevelFor(fc *fileConfig) slog.Level {
+	if fc.LogLevel != "" {
+		return parseLevel(fc.LogLevel)
+	}
+	return parseLevel(c.logLevel)
+}
+
 func parseLevel(level string) slog.Level {
 	switch strings.ToLower(level) {
 	case "debug":
@@ -103,53 +214,360 @@ func parseLevel(level string) slog.Level {
 
 // === Scan ===
 
-func scanOnce(ctx context.Context, l loader, pub *metrics.PromPublisher, logger *slog.Logger) {
+// source is one named loader, scanned on its own interval.
+type source struct {
+	name     string
+	interval time.Duration
+	labels   map[string]string             // added to every cert of this source
+	loader   loader                        // nil for crl sources
+	crls     crlLoader                     // nil unless a crl source
+	watcher  watcher                       // nil unless the source is watched
+	verifier *certloader.ChainVerifier     // nil unless verify_chain
+	revoker  *certloader.RevocationChecker // nil unless check_revocation
+	debounce time.Duration
+	logger   *slog.Logger
+}
+
+func newSource(sc sourceConfig, cfg config, logger *slog.Logger) *source {
+	labels := make(map[string]string, len(sc.Labels)+1)
+	maps.Copy(labels, sc.Labels)
+	if sc.Name != "" {
+		labels["source"] = sc.Name
+		logger = logger.With("source", sc.Name)
+	}
+
+	interval := sc.Interval
+	if interval == 0 {
+		interval = cfg.scanInterval
+	}
+
+	var l loader
+	var cl crlLoader
+	switch sc.Type {
+	case sourceTypeFile:
+		logger.Info("Using file loader", "path", sc.Path)
+		fl := certloader.NewFileLoader(sc.Path, logger)
+		fl.Passwords = sc.passwords()
+		fl.Embedded, fl.DocPaths = sc.Embedded, sc.EmbeddedPaths
+		fl.PairKeys = sc.PairKeys
+		l = fl
+	case sourceTypeDir:
+		logger.Info("Using dir loader", "path", sc.Path)
+		dl := certloader.NewDirLoader(sc.Path, logger)
+		dl.Include, dl.Exclude = sc.Include, sc.Exclude
+		dl.Workers = sc.Workers
+		dl.Cache, dl.CacheID = cfg.cache, sc.Name
+		dl.Passwords = sc.passwords()
+		dl.Embedded, dl.DocPaths = sc.Embedded, sc.EmbeddedPaths
+		dl.PairKeys = sc.PairKeys
+		l = dl
+	case sourceTypeTLS:
+		timeout := sc.Timeout
+		if timeout == 0 {
+			timeout = cfg.tlsTimeout
+		}
+		logger.Info("Using TLS loader", "targets", sc.Targets, "starttls", sc.StartTLS)
+		l = certloader.NewStartTLSLoader(sc.Targets, sc.StartTLS, timeout, logger)
+	case sourceTypeURL:
+		logger.Info("Using URL loader", "urls", sc.URLs)
+		l = certloader.NewURLLoader(sc.URLs, sc.Timeout, logger)
+	case sourceTypeKube:
+		logger.Info("Using Kubernetes loader", "namespace", sc.Namespace, "selector", sc.LabelSelector)
+		kl := certloader.NewKubernetesLoader(sc.Namespace, sc.LabelSelector, logger)
+		kl.ConfigMaps = sc.ConfigMaps
+		kl.Keys = slices.Concat(certloader.DefaultKubernetesKeys, sc.Keys)
+		slices.Sort(kl.Keys)
+		kl.Keys = slices.Compact(kl.Keys) // keys may repeat the defaults
+		kl.Kubeconfig, kl.Context = sc.Kubeconfig, sc.Context
+		kl.Timeout = sc.Timeout
+		l = kl
+	case sourceTypeVault:
+		logger.Info("Using Vault loader", "address", sc.Address, "mounts", sc.Mounts, "auth", sc.Auth.Method)
+		vl := certloader.NewVaultLoader(sc.Address, sc.Mounts, sc.Auth.auth(), logger)
+		vl.CACert = sc.CACert
+		if sc.Timeout > 0 {
+			vl.Timeout = sc.Timeout
+		}
+		l = vl
+	case sourceTypeKubeconfig:
+		logger.Info("Using kubeconfig loader", "path", sc.Path)
+		l = certloader.NewKubeconfigLoader(sc.Path, logger)
+	case sourceTypeCRL:
+		logger.Info("Using CRL loader", "path", sc.Path)
+		cl = certloader.NewCRLLoader(sc.Path, logger)
+	}
+
+	src := &source{name: sc.Name, interval: interval, labels: labels, loader: l, crls: cl, debounce: sc.Debounce, logger: logger}
+	if w, ok := l.(watcher); ok && sc.Watch {
+		src.watcher = w
+	}
+	if sc.VerifyChain {
+		roots := sc.Roots
+		if roots == "" {
+			roots = cfg.roots
+		}
+		src.verifier = certloader.NewChainVerifier(roots, logger)
+	}
+	if sc.CheckRevocation {
+		src.revoker = cfg.revoker
+		if src.revoker == nil {
+			src.revoker = certloader.NewRevocationChecker(cfg.revocationTimeout, logger)
+		}
+	}
+	return src
+}
+
+// verify records chain verification and revocation on certs, when enabled
+// for the source.
+func (src *source) verify(ctx context.Context, certs []*certloader.CertInfo) []*certloader.CertError {
+	var errs []*certloader.CertError
+	if src.verifier != nil {
+		errs = src.verifier.Verify(ctx, certs)
+	}
+	if src.revoker != nil {
+		src.revoker.Check(ctx, certs)
+	}
+	return errs
+}
+
+// label adds the source labels to certs and CRLs.
+func (src *source) label(res scanResult) {
+	if len(src.labels) == 0 {
+		return
+	}
+	for _, c := range res.certs {
+		c.Labels = src.merge(c.Labels)
+	}
+	for _, c := range res.crls {
+		c.Labels = src.merge(c.Labels)
+	}
+}
+
+func (src *source) merge(labels map[string]string) map[string]string {
+	if labels == nil {
+		labels = make(map[string]string, len(src.labels))
+	}
+	maps.Copy(labels, src.labels)
+	return labels
+}
+
+// scanState keeps the latest result of every active source, so that each
+// publish covers all of them whichever source just finished scanning.
+type scanState struct {
+	mu      sync.Mutex
+	pub     *metrics.PromPublisher
+	policy  *certloader.Policy // nil skips the policy checks
+	rules   []*rules.Rule
+	active  map[string]*source
+	results map[string]scanResult
+
+	// Outcome of the rules at the last publish, served on /api/v1/rules
+	ruleResults []rules.Result
+	evaluatedAt time.Time
+}
+
+type scanResult struct {
+	certs []*certloader.CertInfo
+	crls  []*certloader.CRLInfo
+	errs  []*certloader.CertError
+}
+
+func newScanState(pub *metrics.PromPublisher) *scanState {
+	return &scanState{pub: pub, active: make(map[string]*source), results: make(map[string]scanResult)}
+}
+
+// swap makes srcs the active sources. Results of sources that are gone are
+// dropped; a replaced source keeps its last results until its successor scans.
+func (s *scanState) swap(srcs []*source) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := make(map[string]*source, len(srcs))
+	for _, src := range srcs {
+		active[src.name] = src
+	}
+	for name := range s.results {
+		if _, ok := active[name]; !ok {
+			delete(s.results, name)
+		}
+	}
+	s.active = active
+	s.publish()
+}
+
+// update stores the result of one source and republishes every source.
+// Late results of a source that has been swapped out are ignored.
+func (s *scanState) update(src *source, res scanResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active[src.name] != src {
+		return
+	}
+	s.results[src.name] = res
+	s.publish()
+}
+
+// setPolicy replaces the policy checked on the next publish.
+func (s *scanState) setPolicy(p *certloader.Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = p
+}
+
+// activePolicy returns the policy checked on publish.
+func (s *scanState) activePolicy() *certloader.Policy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.policy
+}
+
+// setRules replaces the user-defined rules evaluated on the next publish.
+func (s *scanState) setRules(rs []*rules.Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = rs
+}
+
+func (s *scanState) publish() {
+	var allCerts []*certloader.CertInfo
+	var allCRLs []*certloader.CRLInfo
+	var allErrs []*certloader.CertError
+	for _, n := range slices.Sorted(maps.Keys(s.results)) {
+		allCerts = append(allCerts, s.results[n].certs...)
+		allCRLs = append(allCRLs, s.results[n].crls...)
+		allErrs = append(allErrs, s.results[n].errs...)
+	}
+	if s.policy != nil {
+		s.policy.Check(allCerts)
+	}
+	s.evaluatedAt = s.pub.Clock()
+	s.ruleResults = rules.Evaluate(s.rules, allCerts, s.evaluatedAt)
+	s.pub.PublishCerts(allCerts, allErrs)
+	s.pub.PublishCRLs(allCRLs)
+	s.pub.PublishRules(s.ruleResults)
+}
+
+func scanOnce(ctx context.Context, src *source, state *scanState) {
 	start := time.Now()
-	logger.Info("Starting certificate scan...")
+	src.logger.Info("Starting certificate scan...")
 
-	certs, errs := l.LoadCertificates(ctx)
-	pub.PublishCerts(certs, errs)
-	logger.Info(fmt.Sprintf("Scan done in %s: %d certs, %d errors", time.Since(start), len(certs), len(errs)))
+	var res scanResult
+	if src.loader != nil {
+		res.certs, res.errs = src.loader.LoadCertificates(ctx)
+		res.errs = append(res.errs, src.verify(ctx, res.certs)...)
+	}
+	if src.crls != nil {
+		crls, errs := src.crls.LoadCRLs(ctx)
+		res.crls, res.errs = crls, append(res.errs, errs...)
+	}
+	src.label(res)
+	state.update(src, res)
+	src.logger.Info(fmt.Sprintf("Scan done in %s: %d certs, %d CRLs, %d errors", time.Since(start), len(res.certs), len(res.crls), len(res.errs)))
 }
 
-func scanPeriodic(ctx context.Context, interval time.Duration, l loader, pub *metrics.PromPublisher, logger *slog.Logger) {
-	scanOnceSafe(ctx, l, pub, logger)
+// scanPeriodic scans src every interval and, for watched sources, on
+// filesystem events, until ctx is done or stop is closed. Closing stop never
+// interrupts a full scan in progress.
+func scanPeriodic(ctx context.Context, src *source, state *scanState, stop <-chan struct{}) {
+	scanOnceSafe(ctx, src, state)
+
+	if src.watcher != nil {
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go watchSource(watchCtx, src, state)
+	}
 
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	// A nil channel never fires: watch only
+	var tick <-chan time.Time
+	if src.interval > 0 {
+		ticker := time.NewTicker(src.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			logger.Info("Stopping periodic scan")
+			src.logger.Info("Stopping periodic scan")
 			return
-		case <-ticker.C:
-			scanOnceSafe(ctx, l, pub, logger)
+		case <-stop:
+			src.logger.Info("Stopping periodic scan")
+			return
+		case <-tick:
+			scanOnceSafe(ctx, src, state)
 		}
 	}
 }
 
-func scanOnceSafe(ctx context.Context, l loader, pub *metrics.PromPublisher, logger *slog.Logger) {
+func watchSource(ctx context.Context, src *source, state *scanState) {
+	src.logger.Info("Watching for filesystem changes", "debounce", src.debounce)
+	err := src.watcher.Watch(ctx, src.debounce, func(certs []*certloader.CertInfo, errs []*certloader.CertError) {
+		res := scanResult{certs: certs, errs: append(errs, src.verify(ctx, certs)...)}
+		src.label(res)
+		state.update(src, res)
+		src.logger.Info(fmt.Sprintf("Rescan on filesystem change: %d certs, %d errors", len(certs), len(errs)))
+	})
+	if err != nil {
+		src.logger.Error("Filesystem watch stopped, relying on periodic scans", "error", err)
+	}
+}
+
+func scanOnceSafe(ctx context.Context, src *source, state *scanState) {
 	defer func() {
 		if r := recover(); r != nil {
-			logger.Error(fmt.Sprintf("panic recovered in scan: %v", r))
+			src.logger.Error(fmt.Sprintf("panic recovered in scan: %v", r))
 		}
 	}()
-	scanOnce(ctx, l, pub, logger)
+	scanOnce(ctx, src, state)
 }
 
 // === HTTP Server ===
 
-func serve(ctx context.Context, addr string, logger *slog.Logger) error {
+// rulesResponse is the body of /api/v1/rules.
+type rulesResponse struct {
+	EvaluatedAt time.Time      `json:"evaluated_at"`
+	Rules       []rules.Result `json:"rules"`
+}
+
+// rulesHandler serves the outcome of the user-defined rules at the last
+// publish as JSON.
+func rulesHandler(s *scanState) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "only GET or HEAD requests allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		s.mu.Lock()
+		resp := rulesResponse{EvaluatedAt: s.evaluatedAt, Rules: s.ruleResults}
+		s.mu.Unlock()
+		if resp.Rules == nil {
+			resp.Rules = []rules.Result{}
+		}
+
+		// Expressions read better with their < and > unescaped
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		w.Header().Set("Content-Type", "application/json")
+		_ = enc.Encode(resp)
+	})
+}
+
+func serve(ctx context.Context, cfg config, reloader *reloader, logger *slog.Logger) error {
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/probe", probeHandler(cfg, reloader.sched.state, logger))
+	mux.Handle("/-/reload", reloader)
+	mux.Handle("/api/v1/rules", rulesHandler(reloader.sched.state))
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok\n"))
 	})
 
 	srv := &http.Server{
-		Addr:    addr,
+		Addr:    cfg.listenAddr,
 		Handler: mux,
 	}
 
@@ -160,7 +578,7 @@ func serve(ctx context.Context, addr string, logger *slog.Logger) error {
 		_ = srv.Shutdown(shutdownCtx)
 	}()
 
-	logger.Info(fmt.Sprintf("HTTP server listening on %s", addr))
+	logger.Info(fmt.Sprintf("HTTP server listening on %s", cfg.listenAddr))
 	err := srv.ListenAndServe()
 	if err == http.ErrServerClosed {
 		logger.Info("HTTP server shut down")
@@ -172,8 +590,10 @@ func serve(ctx context.Context, addr string, logger *slog.Logger) error {
 func main() {
 	cfg := parseFlags()
 
+	level := new(slog.LevelVar)
+	level.Set(parseLevel(cfg.logLevel))
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: parseLevel(cfg.logLevel),
+		Level: level,
 	}))
 
 	if err := cfg.validate(); err != nil {
@@ -186,26 +606,40 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	var l loader
-	if cfg.certFile != "" {
-		logger.Info("Using file loader", "path", cfg.certFile)
-		l = certloader.NewFileLoader(cfg.certFile, logger)
-	} else {
-		logger.Info("Using dir loader", "path", cfg.certDir)
-		l = certloader.NewDirLoader(cfg.certDir, logger)
+	fc, err := cfg.load()
+	if err != nil {
+		logger.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+	level.Set(cfg.logLevelFor(fc))
+	if len(fc.Sources) == 0 {
+		logger.Info("No source configured, serving /probe only")
 	}
 
+	if cfg.scanCache {
+		cache, err := certloader.NewScanCache(cfg.scanCacheFile)
+		if err != nil {
+			logger.Warn("Cannot read scan cache, starting empty", "path", cfg.scanCacheFile, "error", err)
+		}
+		cfg.cache = cache
+		metrics.RegisterScanCache(cache.Stats)
+	}
+
+	cfg.revoker = certloader.NewRevocationChecker(cfg.revocationTimeout, logger)
+
 	pub := metrics.NewPromPublisher(time.Now)
 	pub.PerCertMetrics = cfg.perCertMetrics
 
-	if cfg.scanInterval > 0 {
-		logger.Info("Starting periodic scan", "interval", cfg.scanInterval)
-		go scanPeriodic(ctx, cfg.scanInterval, l, pub, logger)
-	} else {
-		scanOnce(ctx, l, pub, logger)
-	}
+	state := newScanState(pub)
+	state.setPolicy(fc.Policy.policy())
+	state.setRules(fc.ruleSet())
+	sched := newScheduler(ctx, cfg, state, logger)
+	sched.apply(fc.Sources)
+
+	reloader := newReloader(cfg, sched, level, logger)
+	go reloader.watchSIGHUP(ctx)
 
-	if err := serve(ctx, cfg.listenAddr, logger); err != nil {
+	if err := serve(ctx, cfg, reloader, logger); err != nil {
 		logger.Error("http server error", "error", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"x509-watch/internal/certloader"
+	"x509-watch/internal/metrics"
+)
+
+// staticLoader returns the same certs on every scan.
+type staticLoader []*certloader.CertInfo
+
+func (l staticLoader) LoadCertificates(context.Context) ([]*certloader.CertInfo, []*certloader.CertError) {
+	out := make([]*certloader.CertInfo, len(l))
+	for i, c := range l {
+		cp := *c
+		out[i] = &cp
+	}
+	return out, nil
+}
+
+// staticCRLLoader returns the same CRLs on every scan.
+type staticCRLLoader []*certloader.CRLInfo
+
+func (l staticCRLLoader) LoadCRLs(context.Context) ([]*certloader.CRLInfo, []*certloader.CertError) {
+	out := make([]*certloader.CRLInfo, len(l))
+	for i, c := range l {
+		cp := *c
+		out[i] = &cp
+	}
+	return out, nil
+}
+
+func TestScanOnce_MergesSources(t *testing.T) {
+	now := time.Now()
+	reg := prometheus.NewRegistry()
+	pub, err := metrics.NewRegistryPublisher(reg, func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+	state := newScanState(pub)
+
+	a := newSource(sourceConfig{Name: "a", Type: sourceTypeFile, Path: "/a.pem", Labels: map[string]string{"team": "infra"}}, config{}, slog.Default())
+	a.loader = staticLoader{{FilePath: "/a.pem", CommonName: "a", NotAfter: now.Add(time.Hour)}}
+	b := newSource(sourceConfig{Name: "b", Type: sourceTypeFile, Path: "/b.pem"}, config{}, slog.Default())
+	b.loader = staticLoader{{FilePath: "/b.pem", CommonName: "b", NotAfter: now.Add(time.Hour)}}
+
+	state.swap([]*source{a, b})
+	scanOnce(context.Background(), a, state)
+	scanOnce(context.Background(), b, state)
+	// Rescanning a source replaces its results, it does not add to them
+	scanOnce(context.Background(), a, state)
+
+	expected := `
+		# HELP x509_cert_expired 1 if certificate is expired, 0 otherwise
+		# TYPE x509_cert_expired gauge
+		x509_cert_expired{common_name="a",filepath="/a.pem",issuer="",serial="",source="a",team="infra"} 0
+		x509_cert_expired{common_name="b",filepath="/b.pem",issuer="",serial="",source="b",team=""} 0
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "x509_cert_expired"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewSource_InheritsDefaults(t *testing.T) {
+	cfg := config{scanInterval: time.Minute, tlsTimeout: 3 * time.Second}
+
+	src := newSource(sourceConfig{Type: sourceTypeTLS, Targets: []string{"example.com"}}, cfg, slog.Default())
+	if src.interval != time.Minute {
+		t.Errorf("expected interval inherited from flags, got %s", src.interval)
+	}
+	if _, ok := src.labels["source"]; ok {
+		t.Errorf("expected no source label for an unnamed source, got %v", src.labels)
+	}
+	if tl, ok := src.loader.(*certloader.TLSLoader); !ok || tl.Timeout != 3*time.Second {
+		t.Errorf("expected TLS loader with inherited timeout, got %#v", src.loader)
+	}
+}
+
+func TestNewSource_VerifyChainInheritsRoots(t *testing.T) {
+	cfg := config{roots: "/etc/ssl/roots.pem"}
+
+	if src := newSource(sourceConfig{Type: sourceTypeFile, Path: "/a.pem"}, cfg, slog.Default()); src.verifier != nil {
+		t.Errorf("expected no verifier without verify_chain")
+	}
+	src := newSource(sourceConfig{Type: sourceTypeFile, Path: "/a.pem", VerifyChain: true}, cfg, slog.Default())
+	if src.verifier == nil || src.verifier.RootsFile != "/etc/ssl/roots.pem" {
+		t.Errorf("expected verifier with inherited roots, got %#v", src.verifier)
+	}
+	src = newSource(sourceConfig{Type: sourceTypeFile, Path: "/a.pem", VerifyChain: true, Roots: "/own.pem"}, cfg, slog.Default())
+	if src.verifier.RootsFile != "/own.pem" {
+		t.Errorf("expected source roots to win, got %q", src.verifier.RootsFile)
+	}
+}
+
+func TestNewSource_SharesRevocationChecker(t *testing.T) {
+	cfg := config{revoker: certloader.NewRevocationChecker(time.Second, slog.Default())}
+
+	a := newSource(sourceConfig{Name: "a", Type: sourceTypeFile, Path: "/a.pem", CheckRevocation: true}, cfg, slog.Default())
+	b := newSource(sourceConfig{Name: "b", Type: sourceTypeTLS, Targets: []string{"x"}, CheckRevocation: true}, cfg, slog.Default())
+	c := newSource(sourceConfig{Name: "c", Type: sourceTypeFile, Path: "/c.pem"}, cfg, slog.Default())
+
+	if a.revoker != cfg.revoker || b.revoker != cfg.revoker {
+		t.Error("expected sources to share the process wide revocation checker")
+	}
+	if c.revoker != nil {
+		t.Error("expected no revocation checker without check_revocation")
+	}
+}
+
+func TestNewSource_KubernetesKeys(t *testing.T) {
+	src := newSource(sourceConfig{Type: sourceTypeKube, Keys: []string{"tls.crt", "cert.pem"}}, config{}, slog.Default())
+	kl, ok := src.loader.(*certloader.KubernetesLoader)
+	if !ok {
+		t.Fatalf("expected a Kubernetes loader, got %T", src.loader)
+	}
+	if got, want := fmt.Sprint(kl.Keys), "[ca.crt cert.pem tls.crt]"; got != want {
+		t.Errorf("expected keys %s, got %s", want, got)
+	}
+}
+
+func TestScanOnce_CRLSource(t *testing.T) {
+	now := time.Now()
+	reg := prometheus.NewRegistry()
+	pub, err := metrics.NewRegistryPublisher(reg, func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+	state := newScanState(pub)
+
+	src := newSource(sourceConfig{Name: "pki", Type: sourceTypeCRL, Path: "/pki"}, config{}, slog.Default())
+	if src.loader != nil || src.crls == nil {
+		t.Fatalf("expected a CRL only source, got %+v", src)
+	}
+	src.crls = staticCRLLoader{{FilePath: "/pki/ca.crl", Issuer: "CA", ThisUpdate: now, RevokedCount: 2}}
+
+	state.swap([]*source{src})
+	scanOnce(context.Background(), src, state)
+
+	expected := `
+		# HELP x509_crl_revoked_entries Number of revoked certificates listed in the CRL
+		# TYPE x509_crl_revoked_entries gauge
+		x509_crl_revoked_entries{filepath="/pki/ca.crl",issuer="CA",source="pki"} 2
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "x509_crl_revoked_entries"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRulesHandler(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	pub, err := metrics.NewRegistryPublisher(reg, func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+	state := newScanState(pub)
+	fc, err := parseFileConfig([]byte(`
+rules:
+  - name: internal_short_lived
+    when: cert.issuer == "Corp Internal CA"
+    expr: cert.lifetime <= duration("90d")
+sources:
+  - {name: a, type: file, path: /x}
+`))
+	if err != nil {
+		t.Fatalf("parseFileConfig: %v", err)
+	}
+	state.setRules(fc.ruleSet())
+
+	src := newSource(sourceConfig{Name: "a", Type: sourceTypeFile, Path: "/a.pem"}, config{}, slog.Default())
+	src.loader = staticLoader{
+		{FilePath: "/a.pem", CommonName: "a", Issuer: "Corp Internal CA", NotBefore: now, NotAfter: now.Add(365 * 24 * time.Hour)},
+		{FilePath: "/b.pem", CommonName: "b", Issuer: "Corp Internal CA", NotBefore: now, NotAfter: now.Add(30 * 24 * time.Hour)},
+		{FilePath: "/c.pem", CommonName: "c", Issuer: "Public CA", NotBefore: now, NotAfter: now.Add(365 * 24 * time.Hour)},
+	}
+	state.swap([]*source{src})
+	scanOnce(context.Background(), src, state)
+
+	expected := `
+		# HELP x509_cert_rule_failed 1 for every user-defined rule the certificate fails
+		# TYPE x509_cert_rule_failed gauge
+		x509_cert_rule_failed{common_name="a",filepath="/a.pem",issuer="Corp Internal CA",rule="internal_short_lived",serial="",source="a"} 1
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "x509_cert_rule_failed"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	rulesHandler(state).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/rules", nil))
+	if ct := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || ct != "application/json" {
+		t.Fatalf("unexpected response %d %q", rec.Code, ct)
+	}
+	want := `{"evaluated_at":"2030-01-01T00:00:00Z","rules":[{"rule":"internal_short_lived",` +
+		`"when":"cert.issuer == \"Corp Internal CA\"","expr":"cert.lifetime <= duration(\"90d\")",` +
+		`"checked":2,"failed":1,"errors":0,"failures":[{"common_name":"a","issuer":"Corp Internal CA",` +
+		`"filepath":"/a.pem","serial":"","labels":{"source":"a"}}]}]}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+
+	rec = httptest.NewRecorder()
+	rulesHandler(state).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/rules", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rec.Code)
+	}
+}
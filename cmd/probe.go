@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"x509-watch/internal/certloader"
+	"x509-watch/internal/metrics"
+)
+
+// === Probe ===
+
+const defaultProbeModule = "tls"
+
+// probeModules builds the loader used by /probe for a given module and target.
+var probeModules = map[string]func(target string, cfg config, logger *slog.Logger) loader{
+	"file": func(target string, _ config, logger *slog.Logger) loader {
+		return certloader.NewFileLoader(target, logger)
+	},
+	"dir": func(target string, _ config, logger *slog.Logger) loader {
+		return certloader.NewDirLoader(target, logger)
+	},
+	"tls": func(target string, cfg config, logger *slog.Logger) loader {
+		return certloader.NewTLSLoader([]string{target}, cfg.tlsTimeout, logger)
+	},
+}
+
+// pathModules read the local filesystem: their targets must sit below
+// --probe-roots, so that callers of /probe cannot walk the whole host.
+var pathModules = map[string]bool{"file": true, "dir": true}
+
+func init() {
+	// One "<proto>_starttls" module per supported STARTTLS protocol
+	for _, proto := range certloader.StartTLSProtocols() {
+		probeModules[proto+"_starttls"] = func(target string, cfg config, logger *slog.Logger) loader {
+			return certloader.NewStartTLSLoader([]string{target}, proto, cfg.tlsTimeout, logger)
+		}
+	}
+}
+
+// probeHandler runs a loader on demand, blackbox_exporter style:
+// /probe?target=example.com:443&module=tls
+// Results are written to a fresh registry so concurrent probes never mix.
+// Certificates are checked against the policy of state, as scans are.
+func probeHandler(cfg config, state *scanState, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		target := q.Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+			return
+		}
+
+		module := q.Get("module")
+		if module == "" {
+			module = defaultProbeModule
+		}
+		newLoader, ok := probeModules[module]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown module %q", module), http.StatusBadRequest)
+			return
+		}
+		if pathModules[module] && !underRoots(target, cfg.probeRoots) {
+			http.Error(w, fmt.Sprintf("module %s only probes targets below --probe-roots", module), http.StatusForbidden)
+			return
+		}
+
+		reg := prometheus.NewRegistry()
+		pub, err := metrics.NewRegistryPublisher(reg, time.Now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_success",
+			Help: "1 if the probe loaded at least one certificate without error, 0 otherwise",
+		})
+		probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_duration_seconds",
+			Help: "Time taken by the probe to load certificates",
+		})
+		reg.MustRegister(probeSuccess, probeDuration)
+
+		ctx, cancel := probeContext(r)
+		defer cancel()
+
+		start := time.Now()
+		certs, errs := newLoader(target, cfg, logger).LoadCertificates(ctx)
+		if policy := state.activePolicy(); policy != nil {
+			policy.Check(certs)
+		}
+		pub.PublishCerts(certs, errs)
+		probeDuration.Set(time.Since(start).Seconds())
+
+		if len(certs) > 0 && len(errs) == 0 {
+			probeSuccess.Set(1)
+		}
+		logger.Debug("Probe done", "module", module, "target", target, "certs", len(certs), "errors", len(errs))
+
+		promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
+
+// underRoots reports whether the absolute path target, symlinks resolved,
+// is one of roots or below one of them.
+func underRoots(target string, roots []string) bool {
+	if !filepath.IsAbs(target) {
+		return false
+	}
+	path := resolvePath(target)
+	for _, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(resolvePath(abs), path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePath returns path with its symlinks resolved, those of its parent
+// directory when path itself does not exist.
+func resolvePath(path string) string {
+	path = filepath.Clean(path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		return filepath.Join(dir, filepath.Base(path))
+	}
+	return path
+}
+
+// probeContext bounds the probe by the scrape timeout Prometheus advertises.
+func probeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+			return context.WithTimeout(r.Context(), time.Duration(secs*float64(time.Second)))
+		}
+	}
+	return context.WithCancel(r.Context())
+}
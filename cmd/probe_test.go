@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"x509-watch/internal/certloader"
+	"x509-watch/internal/metrics"
+)
+
+func probe(t *testing.T, query url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	return probeWith(t, config{tlsTimeout: time.Second}, query)
+}
+
+func probeWith(t *testing.T, cfg config, query url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	state := newScanState(metrics.NewPromPublisher(time.Now))
+	state.setPolicy(certloader.DefaultPolicy())
+	return probeState(t, cfg, state, query)
+}
+
+func probeState(t *testing.T, cfg config, state *scanState, query url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/probe?"+query.Encode(), nil)
+	rec := httptest.NewRecorder()
+	probeHandler(cfg, state, slog.Default()).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestProbeHandler_TLSTarget(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	addr := srv.Listener.Addr().String()
+	rec := probe(t, url.Values{"target": {addr}, "module": {"tls"}})
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "probe_success 1") {
+		t.Errorf("expected probe_success 1, got:\n%s", body)
+	}
+	if !strings.Contains(body, `filepath="`+addr+`"`) {
+		t.Errorf("expected per-cert series for %s, got:\n%s", addr, body)
+	}
+}
+
+func TestProbeHandler_FileTargetError(t *testing.T) {
+	cfg := config{tlsTimeout: time.Second, probeRoots: []string{"/does"}}
+	rec := probeWith(t, cfg, url.Values{"target": {"/does/not/exist.pem"}, "module": {"file"}})
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "probe_success 0") {
+		t.Errorf("expected probe_success 0, got:\n%s", body)
+	}
+	if !strings.Contains(body, `x509_cert_errors_total{error_type="read_error"} 1`) {
+		t.Errorf("expected one read_error, got:\n%s", body)
+	}
+}
+
+func TestProbeHandler_BadRequest(t *testing.T) {
+	if rec := probe(t, url.Values{}); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing target: expected 400, got %d", rec.Code)
+	}
+	if rec := probe(t, url.Values{"target": {"x"}, "module": {"nope"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown module: expected 400, got %d", rec.Code)
+	}
+}
+
+func TestProbeHandler_PathTargetOutsideRoots(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{tlsTimeout: time.Second, probeRoots: []string{root}}
+
+	tests := []struct {
+		name   string
+		cfg    config
+		module string
+		target string
+		want   int
+	}{
+		{"no roots", config{tlsTimeout: time.Second}, "dir", root, http.StatusForbidden},
+		{"host root", cfg, "dir", "/", http.StatusForbidden},
+		{"outside", cfg, "file", filepath.Join(outside, "a.pem"), http.StatusForbidden},
+		{"dot dot", cfg, "file", root + "/../" + filepath.Base(outside) + "/a.pem", http.StatusForbidden},
+		{"symlink", cfg, "dir", filepath.Join(root, "escape"), http.StatusForbidden},
+		{"relative", cfg, "file", "a.pem", http.StatusForbidden},
+		{"root", cfg, "dir", root, http.StatusOK},
+		{"below", cfg, "file", filepath.Join(root, "sub", "a.pem"), http.StatusOK},
+	}
+	for _, tc := range tests {
+		rec := probeWith(t, tc.cfg, url.Values{"target": {tc.target}, "module": {tc.module}})
+		if rec.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestProbeHandler_ActivePolicy(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(200 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	path := filepath.Join(root, "leaf.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{probeRoots: []string{root}}
+	query := url.Values{"target": {path}, "module": {"file"}}
+	violation := `x509_cert_policy_violation{common_name="leaf",filepath="` + path + `",issuer="leaf",rule="max_validity",serial="1"} 1`
+
+	// 200 days are within the default 398
+	if body := probeWith(t, cfg, query).Body.String(); strings.Contains(body, violation) {
+		t.Errorf("expected no violation with the default policy, got:\n%s", body)
+	}
+
+	// The configured policy, replaced on reload, applies to probes too
+	state := newScanState(metrics.NewPromPublisher(time.Now))
+	state.setPolicy(policyConfig{MaxValidityDays: 90}.policy())
+	if body := probeState(t, cfg, state, query).Body.String(); !strings.Contains(body, violation) {
+		t.Errorf("expected %s, got:\n%s", violation, body)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"x509-watch/internal/metrics"
+)
+
+// === Scheduler ===
+
+// scheduler runs the configured sources and swaps them on reload. Unchanged
+// sources keep running untouched, changed or new ones are started, removed
+// ones are stopped once their current scan (if any) is done.
+type scheduler struct {
+	ctx    context.Context
+	cfg    config
+	state  *scanState
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	running map[string]*runningSource
+}
+
+type runningSource struct {
+	conf sourceConfig
+	src  *source
+	stop chan struct{} // nil for one-shot, unwatched sources
+}
+
+func newScheduler(ctx context.Context, cfg config, state *scanState, logger *slog.Logger) *scheduler {
+	return &scheduler{
+		ctx:     ctx,
+		cfg:     cfg,
+		state:   state,
+		logger:  logger,
+		running: make(map[string]*runningSource),
+	}
+}
+
+// apply makes scs the running sources. One-shot sources (interval 0, not
+// watched) are scanned before apply returns, but after the scheduler is
+// unlocked: a concurrent reload never waits for a scan. Should it swap them
+// out meanwhile, their results are dropped by scanState.update.
+func (s *scheduler) apply(scs []sourceConfig) {
+	for _, src := range s.swap(scs) {
+		scanOnceSafe(s.ctx, src, s.state)
+	}
+}
+
+// swap makes scs the running sources, starts the periodic or watched ones
+// and returns the one-shot ones still to scan.
+func (s *scheduler) swap(scs []sourceConfig) []*source {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := make(map[string]*runningSource, len(scs))
+	srcs := make([]*source, 0, len(scs))
+	var started []*runningSource
+
+	for _, sc := range scs {
+		rs, ok := s.running[sc.Name]
+		if !ok || !reflect.DeepEqual(rs.conf, sc) {
+			rs = &runningSource{conf: sc, src: newSource(sc, s.cfg, s.logger)}
+			if rs.src.interval > 0 || rs.src.watcher != nil {
+				rs.stop = make(chan struct{})
+			}
+			started = append(started, rs)
+		}
+		next[sc.Name] = rs
+		srcs = append(srcs, rs.src)
+	}
+
+	for name, rs := range s.running {
+		if next[name] != rs && rs.stop != nil {
+			close(rs.stop)
+		}
+	}
+	s.running = next
+	s.state.swap(srcs)
+
+	var oneShot []*source
+	for _, rs := range started {
+		if rs.stop == nil {
+			oneShot = append(oneShot, rs.src)
+			continue
+		}
+		if rs.src.interval > 0 {
+			rs.src.logger.Info("Starting periodic scan", "interval", rs.src.interval)
+		}
+		go scanPeriodic(s.ctx, rs.src, s.state, rs.stop)
+	}
+	return oneShot
+}
+
+// === Reload ===
+
+// reloader re-reads --config on SIGHUP or POST /-/reload. An invalid file is
+// rejected and the current sources keep running.
+type reloader struct {
+	cfg    config
+	sched  *scheduler
+	level  *slog.LevelVar
+	logger *slog.Logger
+}
+
+func newReloader(cfg config, sched *scheduler, level *slog.LevelVar, logger *slog.Logger) *reloader {
+	return &reloader{cfg: cfg, sched: sched, level: level, logger: logger}
+}
+
+func (r *reloader) reload() error {
+	if r.cfg.configFile == "" {
+		return fmt.Errorf("nothing to reload, x509-watch was not started with --config")
+	}
+
+	fc, err := loadFileConfig(r.cfg.configFile)
+	if err != nil {
+		metrics.SetConfigReload(false, time.Now())
+		r.logger.Error("config reload rejected, keeping the current one", "error", err)
+		return err
+	}
+
+	r.level.Set(r.cfg.logLevelFor(fc))
+	r.sched.state.setPolicy(fc.Policy.policy())
+	r.sched.state.setRules(fc.ruleSet())
+	r.sched.apply(fc.Sources)
+	metrics.SetConfigReload(true, time.Now())
+	r.logger.Info("Config reloaded", "path", r.cfg.configFile, "sources", len(fc.Sources))
+	return nil
+}
+
+func (r *reloader) watchSIGHUP(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logger.Info("SIGHUP received, reloading config")
+			_ = r.reload()
+		}
+	}
+}
+
+// ServeHTTP handles POST /-/reload.
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost && req.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "only POST or PUT requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.reload(); err != nil {
+		http.Error(w, fmt.Sprintf("failed to reload config: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"x509-watch/internal/metrics"
+)
+
+func newTestScheduler(t *testing.T, cfg config) (*scheduler, *prometheus.Registry) {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	pub, err := metrics.NewRegistryPublisher(reg, time.Now)
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return newScheduler(ctx, cfg, newScanState(pub), slog.Default()), reg
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+}
+
+func TestScheduler_ApplyKeepsUnchangedSources(t *testing.T) {
+	sched, reg := newTestScheduler(t, config{})
+
+	sched.apply([]sourceConfig{
+		{Name: "a", Type: sourceTypeFile, Path: "/a.pem"},
+		{Name: "b", Type: sourceTypeFile, Path: "/b.pem"},
+	})
+	a, b := sched.running["a"].src, sched.running["b"].src
+
+	if got, _ := testutil.GatherAndCount(reg, "x509_cert_errors_total"); got != 1 {
+		t.Fatalf("expected one error series (read_error), got %d", got)
+	}
+
+	// a unchanged, b changed, c new
+	sched.apply([]sourceConfig{
+		{Name: "a", Type: sourceTypeFile, Path: "/a.pem"},
+		{Name: "b", Type: sourceTypeFile, Path: "/b2.pem"},
+		{Name: "c", Type: sourceTypeFile, Path: "/c.pem"},
+	})
+	if sched.running["a"].src != a {
+		t.Error("expected unchanged source a to keep running")
+	}
+	if sched.running["b"].src == b {
+		t.Error("expected changed source b to be replaced")
+	}
+
+	// A late scan of the replaced b must be ignored
+	sched.state.update(b, scanResult{})
+	if _, ok := sched.state.results["b"]; !ok || sched.state.results["b"].errs == nil {
+		t.Error("expected late result of replaced source to be ignored")
+	}
+
+	// Removing a source drops its results
+	sched.apply([]sourceConfig{{Name: "a", Type: sourceTypeFile, Path: "/a.pem"}})
+	if _, ok := sched.state.results["b"]; ok {
+		t.Error("expected results of removed source b to be dropped")
+	}
+}
+
+func TestScheduler_ApplyScansOneShotUnlocked(t *testing.T) {
+	sched, _ := newTestScheduler(t, config{})
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	scs := []sourceConfig{{Name: "slow", Type: sourceTypeURL, URLs: []string{srv.URL + "/ca.pem"}}}
+	go sched.apply(scs)
+	<-entered
+
+	// A reload while the one-shot scan is in progress does not wait for it
+	done := make(chan struct{})
+	go func() {
+		sched.apply(scs)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("apply blocked on the one-shot scan in progress")
+	}
+}
+
+func TestReloader_RejectsInvalidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "log_level: debug\nsources:\n  - {name: a, type: file, path: /a.pem}\n")
+
+	cfg := config{configFile: path, logLevel: "info"}
+	sched, _ := newTestScheduler(t, cfg)
+	level := new(slog.LevelVar)
+	r := newReloader(cfg, sched, level, slog.Default())
+
+	if err := r.reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if level.Level() != slog.LevelDebug {
+		t.Errorf("expected log level from config, got %s", level.Level())
+	}
+	a := sched.running["a"].src
+
+	writeConfig(t, path, "sources:\n  - {name: a, type: nope}\n")
+	if err := r.reload(); err == nil {
+		t.Fatal("expected invalid config to be rejected")
+	}
+	if sched.running["a"].src != a || len(sched.running) != 1 {
+		t.Error("expected the previous sources to keep running")
+	}
+	if level.Level() != slog.LevelDebug {
+		t.Errorf("expected log level unchanged, got %s", level.Level())
+	}
+}
+
+func TestReloader_HTTP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "sources:\n  - {name: a, type: file, path: /a.pem}\n")
+
+	cfg := config{configFile: path, logLevel: "info"}
+	sched, _ := newTestScheduler(t, cfg)
+	r := newReloader(cfg, sched, new(slog.LevelVar), slog.Default())
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/-/reload", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET: expected 405, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := sched.running["a"]; !ok {
+		t.Fatal("expected source a to be running after reload")
+	}
+
+	// Started without --config: nothing to reload
+	r = newReloader(config{}, sched, new(slog.LevelVar), slog.Default())
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("POST without --config: expected 500, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,208 @@
+package certloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Bump when CertInfo/CertError change shape, older cache files are discarded.
+const scanCacheFormat = 6
+
+// ScanCache remembers the result of every parsed file. An entry is reused as
+// long as the file keeps the same mtime, size and inode, so unchanged files
+// are neither read nor parsed again. Entries are keyed by path and parse
+// options (see DirLoader.parseOptions): loaders sharing the cache with
+// different options never get each other's results. Safe for concurrent use.
+type ScanCache struct {
+	Path string // optional file the cache is persisted to, see Save
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// CacheStats are the counters of a ScanCache since it was created.
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+// fileStamp identifies one version of a file without reading it.
+type fileStamp struct {
+	ModTime int64  `json:"mtime"` // unix nanoseconds
+	Size    int64  `json:"size"`
+	Inode   uint64 `json:"inode"`
+}
+
+type cacheEntry struct {
+	Path    string      `json:"path"`
+	Options string      `json:"options"`
+	Stamp   fileStamp   `json:"stamp"`
+	Certs   []*CertInfo `json:"certs"`
+	Keys    []*KeyInfo  `json:"keys,omitempty"`
+	Errs    []cacheErr  `json:"errs"`
+	Owners  []string    `json:"owners"` // DirLoader.CacheID of the loaders using the entry, see prune
+}
+
+func cacheKey(path, options string) string {
+	return options + "\x00" + path
+}
+
+// cacheErr is a CertError in a JSON friendly form.
+type cacheErr struct {
+	Path string        `json:"path"`
+	Type CertErrorType `json:"type"`
+	Msg  string        `json:"msg"`
+}
+
+type cacheFile struct {
+	Format  int                   `json:"format"`
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+// NewScanCache returns an empty cache, or the one persisted at path if any.
+// A missing file is not an error; an unreadable one yields an empty cache
+// along with the error.
+func NewScanCache(path string) (*ScanCache, error) {
+	c := &ScanCache{Path: path, entries: make(map[string]cacheEntry)}
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+
+	var f cacheFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return c, fmt.Errorf("decode scan cache %s: %w", path, err)
+	}
+	if f.Format == scanCacheFormat && f.Entries != nil {
+		c.entries = f.Entries
+	}
+	return c, nil
+}
+
+func (c *ScanCache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: entries}
+}
+
+func stampOf(fi os.FileInfo) fileStamp {
+	return fileStamp{ModTime: fi.ModTime().UnixNano(), Size: fi.Size(), Inode: inode(fi)}
+}
+
+// get returns a copy of the cached result of path parsed with options if
+// stamp still matches, and records owner as a user of the entry.
+func (c *ScanCache) get(owner, path, options string, stamp fileStamp) (fileResult, bool) {
+	key := cacheKey(path, options)
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok && e.Stamp == stamp && !slices.Contains(e.Owners, owner) {
+		e.Owners = append(slices.Clone(e.Owners), owner)
+		c.entries[key] = e
+	}
+	c.mu.Unlock()
+
+	if !ok || e.Stamp != stamp {
+		c.misses.Add(1)
+		return fileResult{}, false
+	}
+	c.hits.Add(1)
+
+	res := fileResult{}
+	for _, ci := range e.Certs {
+		res.certs = append(res.certs, ci.clone())
+	}
+	res.keys = e.Keys
+	for _, ce := range e.Errs {
+		res.errs = append(res.errs, NewCertError(ce.Path, ce.Type, errors.New(ce.Msg)))
+	}
+	return res, true
+}
+
+func (c *ScanCache) put(owner, path, options string, stamp fileStamp, res fileResult) {
+	e := cacheEntry{Path: path, Options: options, Stamp: stamp, Keys: res.keys}
+	for _, ci := range res.certs {
+		// Labels set by the loader itself (alias, location) are kept
+		e.Certs = append(e.Certs, ci.clone())
+	}
+	for _, ce := range res.errs {
+		e.Errs = append(e.Errs, cacheErr{Path: ce.Path, Type: ce.Type, Msg: ce.Err.Error()})
+	}
+
+	key := cacheKey(path, options)
+	c.mu.Lock()
+	e.Owners = append(e.Owners, owner)
+	for _, o := range c.entries[key].Owners {
+		if o != owner {
+			e.Owners = append(e.Owners, o)
+		}
+	}
+	c.entries[key] = e
+	c.mu.Unlock()
+}
+
+// prune releases the entries of owner that are parsed with other options
+// or that keep rejects (files gone since). Entries left without any owner
+// are dropped; those another loader still uses are kept.
+func (c *ScanCache) prune(owner, options string, keep func(path string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, e := range c.entries {
+		if !slices.Contains(e.Owners, owner) || (e.Options == options && keep(e.Path)) {
+			continue
+		}
+		e.Owners = slices.DeleteFunc(slices.Clone(e.Owners), func(o string) bool { return o == owner })
+		if len(e.Owners) == 0 {
+			delete(c.entries, key)
+		} else {
+			c.entries[key] = e
+		}
+	}
+}
+
+// Save writes the cache to Path (no-op without Path). The file is replaced
+// atomically so a crash never leaves a truncated cache behind.
+func (c *ScanCache) Save() error {
+	if c.Path == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	data, err := json.Marshal(cacheFile{Format: scanCacheFormat, Entries: c.entries})
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.Path), ".x509-watch-cache-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.Path)
+}
@@ -0,0 +1,140 @@
+package certloader
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirLoader_CacheSkipsUnchangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeFile(t, dir, "a.pem", generateTestCert(t, "a", now.Add(-time.Hour), now.Add(time.Hour)))
+	writeFile(t, dir, "b.pem", generateTestCert(t, "b", now.Add(-time.Hour), now.Add(time.Hour)))
+	writeFile(t, dir, "bad.pem", []byte("not a cert"))
+
+	cache, err := NewScanCache("")
+	if err != nil {
+		t.Fatalf("NewScanCache: %v", err)
+	}
+	loader := NewDirLoader(dir, slog.Default())
+	loader.Cache = cache
+
+	certs, errs := loader.LoadCertificates(context.Background())
+	if len(certs) != 2 || len(errs) != 1 {
+		t.Fatalf("expected 2 certs and 1 error, got %d and %d", len(certs), len(errs))
+	}
+	if s := cache.Stats(); s.Hits != 0 || s.Misses != 3 || s.Entries != 3 {
+		t.Fatalf("unexpected stats after first scan: %+v", s)
+	}
+
+	// Labels set by callers must not leak into the cache
+	certs[0].Labels = map[string]string{"source": "x"}
+
+	certs, errs = loader.LoadCertificates(context.Background())
+	if len(certs) != 2 || len(errs) != 1 || errs[0].Type != ErrTypePEM {
+		t.Fatalf("unexpected second scan: %d certs, %v", len(certs), errs)
+	}
+	if certs[0].Labels != nil {
+		t.Errorf("expected cached cert without labels, got %v", certs[0].Labels)
+	}
+	if s := cache.Stats(); s.Hits != 3 || s.Misses != 3 {
+		t.Fatalf("expected every file to hit, got %+v", s)
+	}
+
+	// Rewriting a file changes its size/mtime; removing one drops its entry
+	writeFile(t, dir, "a.pem", generateTestCert(t, "a2", now.Add(-time.Hour), now.Add(time.Hour)))
+	if err := os.Remove(filepath.Join(dir, "b.pem")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	certs, _ = loader.LoadCertificates(context.Background())
+	if len(certs) != 1 || certs[0].CommonName != "a2" {
+		t.Fatalf("expected the rewritten cert only, got %v", commonNames(certs))
+	}
+	if s := cache.Stats(); s.Hits != 4 || s.Misses != 4 || s.Entries != 2 {
+		t.Fatalf("unexpected stats after change: %+v", s)
+	}
+}
+
+func TestDirLoader_SharedCache(t *testing.T) {
+	now := time.Now()
+	dir := t.TempDir()
+	writeFile(t, dir, "a.pem", generateTestCert(t, "a", now.Add(-time.Hour), now.Add(time.Hour)))
+	writeFile(t, dir, "values.yaml", []byte("tls:\n  cert: |\n"+indent(string(generateTestCert(t, "web", now, now.Add(time.Hour))), "    ")))
+
+	cache, _ := NewScanCache("")
+	all := NewDirLoader(dir, slog.Default())
+	all.Cache, all.CacheID, all.Embedded = cache, "all", true
+	pem := NewDirLoader(dir, slog.Default())
+	pem.Cache, pem.CacheID, pem.Include = cache, "pem", []string{"*.pem"}
+	whole := NewDirLoader(dir, slog.Default())
+	whole.Cache, whole.CacheID = cache, "whole"
+
+	for i := 0; i < 2; i++ {
+		if certs, _ := all.LoadCertificates(context.Background()); len(certs) != 2 {
+			t.Fatalf("scan %d: expected a and web embedded, got %v", i, commonNames(certs))
+		}
+		// Same tree, other options: the embedded result must not be served
+		if certs, errs := whole.LoadCertificates(context.Background()); len(certs) != 1 || len(errs) != 1 {
+			t.Fatalf("scan %d: expected a and a pem_error for values.yaml, got %v and %v", i, commonNames(certs), errs)
+		}
+		// Fewer files: pruning must not drop what the other loaders use
+		if certs, _ := pem.LoadCertificates(context.Background()); len(certs) != 1 {
+			t.Fatalf("scan %d: expected a only, got %v", i, commonNames(certs))
+		}
+	}
+	if s := cache.Stats(); s.Entries != 4 || s.Misses != 4 || s.Hits != 6 {
+		t.Errorf("expected every loader to hit on the second scan, got %+v", s)
+	}
+}
+
+func TestScanCache_Persistence(t *testing.T) {
+	dir := t.TempDir()
+	certDir := filepath.Join(dir, "certs")
+	if err := os.Mkdir(certDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	now := time.Now()
+	writeFile(t, certDir, "a.pem", generateTestCert(t, "a", now.Add(-time.Hour), now.Add(time.Hour)))
+	cachePath := filepath.Join(dir, "cache.json")
+
+	first, err := NewScanCache(cachePath)
+	if err != nil {
+		t.Fatalf("NewScanCache: %v", err)
+	}
+	loader := NewDirLoader(certDir, slog.Default())
+	loader.Cache = first
+	loader.LoadCertificates(context.Background())
+
+	// A new process reads the file back and reuses every entry
+	second, err := NewScanCache(cachePath)
+	if err != nil {
+		t.Fatalf("NewScanCache reload: %v", err)
+	}
+	loader = NewDirLoader(certDir, slog.Default())
+	loader.Cache = second
+	certs, _ := loader.LoadCertificates(context.Background())
+
+	if len(certs) != 1 || certs[0].CommonName != "a" || !certs[0].NotAfter.Equal(now.Add(time.Hour).Truncate(time.Second)) {
+		t.Fatalf("unexpected certs from persisted cache: %+v", certs)
+	}
+	if s := second.Stats(); s.Hits != 1 || s.Misses != 0 {
+		t.Fatalf("expected a hit from the persisted cache, got %+v", s)
+	}
+}
+
+func TestNewScanCache_CorruptFile(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "cache.json", []byte("{not json"))
+
+	cache, err := NewScanCache(path)
+	if err == nil {
+		t.Fatal("expected an error for a corrupt cache file")
+	}
+	if cache == nil || cache.Stats().Entries != 0 {
+		t.Fatalf("expected an empty usable cache, got %+v", cache)
+	}
+}
@@ -1,8 +1,15 @@
 package certloader
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"maps"
 	"time"
 )
 
@@ -12,6 +19,143 @@ type CertInfo struct {
 	Issuer     string
 	NotBefore  time.Time
 	NotAfter   time.Time
+
+	// Identity and crypto metadata
+	SANs               []string // DNS names, IPs, emails and URIs
+	SerialNumber       string   // lowercase hex
+	Fingerprint        string   // SHA-256 of the DER, lowercase hex
+	PublicKeySHA256    string   // SHA-256 of the SubjectPublicKeyInfo, lowercase hex
+	KeyAlgorithm       string   // RSA, ECDSA, Ed25519...
+	KeySize            int      // bits, 0 when unknown
+	SignatureAlgorithm string
+	IsCA               bool
+	KeyUsages          []string // e.g. digital_signature, key_encipherment
+	ExtKeyUsages       []string // e.g. server_auth, client_auth
+
+	// DER encoding, kept for chain verification
+	Raw []byte
+
+	// Set on the leaf of a bundle by ChainVerifier, nil when not verified
+	Chain *ChainStatus
+
+	// Set by RevocationChecker, nil when not checked
+	Revocation *RevocationStatus
+
+	// Set when private keys are paired, nil otherwise (see KeyStatus)
+	Key *KeyStatus
+
+	// Policy rules the certificate breaks, set by Policy.Check
+	Violations []string
+
+	// User-defined rules the certificate fails, set by rules.Evaluate
+	FailedRules []string
+
+	// Extra metric labels (source name, user-defined labels...)
+	Labels map[string]string
+}
+
+// Build a CertInfo from a parsed certificate found at path
+func newCertInfo(path string, cert *x509.Certificate) *CertInfo {
+	fingerprint := sha256.Sum256(cert.Raw)
+	pub := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return &CertInfo{
+		FilePath:           path,
+		CommonName:         cert.Subject.CommonName,
+		Issuer:             cert.Issuer.CommonName,
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		SANs:               subjectAltNames(cert),
+		SerialNumber:       cert.SerialNumber.Text(16),
+		Fingerprint:        hex.EncodeToString(fingerprint[:]),
+		PublicKeySHA256:    hex.EncodeToString(pub[:]),
+		KeyAlgorithm:       cert.PublicKeyAlgorithm.String(),
+		KeySize:            publicKeySize(cert.PublicKey),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		IsCA:               cert.IsCA,
+		KeyUsages:          keyUsages(cert.KeyUsage),
+		ExtKeyUsages:       extKeyUsages(cert.ExtKeyUsage),
+		Raw:                cert.Raw,
+	}
+}
+
+func subjectAltNames(cert *x509.Certificate) []string {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
+func publicKeySize(pub any) int {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return 256
+	}
+	return 0
+}
+
+// keyUsageNames follows the bit order of x509.KeyUsage.
+var keyUsageNames = []string{
+	"digital_signature",
+	"content_commitment",
+	"key_encipherment",
+	"data_encipherment",
+	"key_agreement",
+	"cert_sign",
+	"crl_sign",
+	"encipher_only",
+	"decipher_only",
+}
+
+func keyUsages(ku x509.KeyUsage) []string {
+	var names []string
+	for i, name := range keyUsageNames {
+		if ku&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any",
+	x509.ExtKeyUsageServerAuth:      "server_auth",
+	x509.ExtKeyUsageClientAuth:      "client_auth",
+	x509.ExtKeyUsageCodeSigning:     "code_signing",
+	x509.ExtKeyUsageEmailProtection: "email_protection",
+	x509.ExtKeyUsageIPSECEndSystem:  "ipsec_end_system",
+	x509.ExtKeyUsageIPSECTunnel:     "ipsec_tunnel",
+	x509.ExtKeyUsageIPSECUser:       "ipsec_user",
+	x509.ExtKeyUsageTimeStamping:    "time_stamping",
+	x509.ExtKeyUsageOCSPSigning:     "ocsp_signing",
+}
+
+func extKeyUsages(ekus []x509.ExtKeyUsage) []string {
+	var names []string
+	for _, eku := range ekus {
+		name, ok := extKeyUsageNames[eku]
+		if !ok {
+			name = fmt.Sprintf("unknown_%d", eku)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// clone returns a copy of c that can be labelled without touching c.
+func (c *CertInfo) clone() *CertInfo {
+	cp := *c
+	cp.Labels = maps.Clone(c.Labels)
+	return &cp
 }
 
 // Return time expiration (negative if already expired)
@@ -24,11 +168,53 @@ func (c *CertInfo) ValidSinceSeconds(now time.Time) float64 {
 	return now.Sub(c.NotBefore).Seconds()
 }
 
+// Return the length of the validity period
+func (c *CertInfo) LifetimeSeconds() float64 {
+	return c.NotAfter.Sub(c.NotBefore).Seconds()
+}
+
+// Return the fraction of the validity period elapsed: 0 until NotBefore, 1
+// from NotAfter on. ok is false for an empty or inverted period.
+func (c *CertInfo) LifetimeConsumedRatio(now time.Time) (ratio float64, ok bool) {
+	lifetime := c.LifetimeSeconds()
+	if lifetime <= 0 {
+		return 0, false
+	}
+	return min(max(c.ValidSinceSeconds(now)/lifetime, 0), 1), true
+}
+
 // Indicate if certificate expire now
 func (c *CertInfo) IsExpired(now time.Time) bool {
 	return now.After(c.NotAfter)
 }
 
+// ValidityState tells where a point in time falls in the validity period of
+// a certificate.
+type ValidityState string
+
+const (
+	StateNotYetValid ValidityState = "not_yet_valid" // before NotBefore: clock skew, back-dated issuance mistake...
+	StateValid       ValidityState = "valid"
+	StateExpired     ValidityState = "expired"
+)
+
+// ValidityStates returns every state, in lifecycle order.
+func ValidityStates() []ValidityState {
+	return []ValidityState{StateNotYetValid, StateValid, StateExpired}
+}
+
+// Return the validity state at now, expired winning over not yet valid for
+// an inverted period
+func (c *CertInfo) ValidityState(now time.Time) ValidityState {
+	switch {
+	case c.IsExpired(now):
+		return StateExpired
+	case now.Before(c.NotBefore):
+		return StateNotYetValid
+	}
+	return StateValid
+}
+
 type CertErrorType string
 
 const (
@@ -36,6 +222,22 @@ const (
 	ErrTypeParse   CertErrorType = "parse_error"
 	ErrTypePEM     CertErrorType = "pem_error"
 	ErrTypeUnknown CertErrorType = "unknown_error"
+
+	// Keystore (PKCS#12...) could not be opened with any configured password
+	ErrTypePassword CertErrorType = "password_error"
+
+	// Endpoint (TLS) errors
+	ErrTypeDial      CertErrorType = "dial_error"
+	ErrTypeHandshake CertErrorType = "handshake_error"
+	ErrTypeTimeout   CertErrorType = "timeout_error"
+	ErrTypeStartTLS  CertErrorType = "starttls_error"
+
+	// Remote document (URL) could not be downloaded: network error, timeout
+	// or non 200 status
+	ErrTypeFetch CertErrorType = "fetch_error"
+
+	// Private key matching no certificate of its source (PairKeys)
+	ErrTypeOrphanKey CertErrorType = "orphan_key"
 )
 
 // Encapsulation of an error of a certificate
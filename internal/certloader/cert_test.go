@@ -1,7 +1,17 @@
 package certloader
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
 	"errors"
+	"math/big"
+	"net"
+	"slices"
 	"testing"
 	"time"
 )
@@ -24,6 +34,32 @@ func TestCertificateInfo_IsExpired(t *testing.T) {
 	}
 }
 
+func TestCertificateInfo_ValidityState(t *testing.T) {
+	now := time.Now()
+	c := &CertInfo{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)}
+
+	tests := []struct {
+		at   time.Time
+		want ValidityState
+	}{
+		{now.Add(-2 * time.Hour), StateNotYetValid},
+		{now.Add(-time.Hour), StateValid}, // bounds are inclusive
+		{now, StateValid},
+		{now.Add(time.Hour), StateValid},
+		{now.Add(2 * time.Hour), StateExpired},
+	}
+	for _, tc := range tests {
+		if got := c.ValidityState(tc.at); got != tc.want {
+			t.Errorf("at %s: expected %s, got %s", tc.at.Sub(now), tc.want, got)
+		}
+	}
+
+	inverted := &CertInfo{NotBefore: now.Add(time.Hour), NotAfter: now.Add(-time.Hour)}
+	if got := inverted.ValidityState(now); got != StateExpired {
+		t.Errorf("inverted period: expected %s, got %s", StateExpired, got)
+	}
+}
+
 func TestCertificateInfo_ExpiresInSeconds(t *testing.T) {
 	now := time.Now()
 
@@ -60,6 +96,37 @@ func TestCertificateInfo_ValidSinceSeconds(t *testing.T) {
 	}
 }
 
+func TestCertificateInfo_LifetimeConsumedRatio(t *testing.T) {
+	now := time.Now()
+	c := &CertInfo{NotBefore: now.Add(-18 * time.Hour), NotAfter: now.Add(6 * time.Hour)}
+	if got := c.LifetimeSeconds(); got != 86400 {
+		t.Fatalf("expected 86400 seconds, got %f", got)
+	}
+
+	tests := []struct {
+		at   time.Time
+		want float64
+	}{
+		{now, 0.75},
+		{now.Add(-18 * time.Hour), 0},
+		{now.Add(-48 * time.Hour), 0}, // not yet valid
+		{now.Add(6 * time.Hour), 1},
+		{now.Add(48 * time.Hour), 1}, // expired
+	}
+	for _, tc := range tests {
+		got, ok := c.LifetimeConsumedRatio(tc.at)
+		if !ok || got != tc.want {
+			t.Errorf("at %s: expected %f, got %f (%v)", tc.at.Sub(now), tc.want, got, ok)
+		}
+	}
+
+	// No validity period to consume
+	empty := &CertInfo{NotBefore: now, NotAfter: now}
+	if _, ok := empty.LifetimeConsumedRatio(now); ok {
+		t.Errorf("expected no ratio for an empty validity period")
+	}
+}
+
 func TestCertError_Error(t *testing.T) {
 	err := NewCertError("/path/cert.pem", ErrTypeParse, errors.New("bad ASN.1"))
 	msg := err.Error()
@@ -86,3 +153,55 @@ func TestNewCertError_NilErr(t *testing.T) {
 		t.Fatalf("expected default error message %q, got %q", ErrTypePEM, cerr.Err.Error())
 	}
 }
+
+func TestNewCertInfo_Metadata(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(0xbeef),
+		Subject:               pkix.Name{CommonName: "ca.example.com"},
+		DNSNames:              []string{"ca.example.com"},
+		IPAddresses:           []net.IP{net.ParseIP("192.0.2.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+
+	ci := newCertInfo("/ca.pem", cert)
+	sum := sha256.Sum256(der)
+
+	if ci.SerialNumber != "beef" {
+		t.Errorf("expected serial beef, got %q", ci.SerialNumber)
+	}
+	if ci.Fingerprint != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected fingerprint %q", ci.Fingerprint)
+	}
+	if !slices.Equal(ci.SANs, []string{"ca.example.com", "192.0.2.1"}) {
+		t.Errorf("unexpected SANs %v", ci.SANs)
+	}
+	if ci.KeyAlgorithm != "ECDSA" || ci.KeySize != 384 || ci.SignatureAlgorithm != "ECDSA-SHA384" {
+		t.Errorf("unexpected key info: %s %d %s", ci.KeyAlgorithm, ci.KeySize, ci.SignatureAlgorithm)
+	}
+	if !ci.IsCA {
+		t.Error("expected IsCA")
+	}
+	if !slices.Equal(ci.KeyUsages, []string{"digital_signature", "cert_sign", "crl_sign"}) {
+		t.Errorf("unexpected key usages %v", ci.KeyUsages)
+	}
+	if !slices.Equal(ci.ExtKeyUsages, []string{"server_auth", "client_auth"}) {
+		t.Errorf("unexpected ext key usages %v", ci.ExtKeyUsages)
+	}
+}
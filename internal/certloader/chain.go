@@ -0,0 +1,233 @@
+package certloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ChainFailure tells why a bundle does not chain to a trusted root.
+type ChainFailure string
+
+const (
+	ChainUnknownAuthority    ChainFailure = "unknown_authority"    // ends on a self-signed root that is not trusted
+	ChainMissingIntermediate ChainFailure = "missing_intermediate" // ends on a cert whose issuer is neither in the bundle nor trusted
+	ChainExpiredIntermediate ChainFailure = "expired_intermediate" // an issuer in the bundle is expired or not yet valid
+	ChainWrongOrder          ChainFailure = "wrong_order"          // verifies, but the bundle is not leaf first then issuers
+	ChainExpired             ChainFailure = "expired"              // the leaf itself is expired or not yet valid
+	ChainInvalid             ChainFailure = "invalid"              // any other verification error
+)
+
+type ChainStatus struct {
+	Valid  bool
+	Reason ChainFailure // empty when valid
+}
+
+// ChainVerifier checks that every bundle (certs sharing a FilePath: a file or
+// a TLS endpoint, and their bundleLabels) chains to a trusted root, and
+// records the result on the bundle's leaf.
+type ChainVerifier struct {
+	// PEM/DER bundle of trusted roots, re-read on every Verify. Empty means
+	// the system pool.
+	RootsFile string
+	Clock     func() time.Time
+	Logger    *slog.Logger
+}
+
+func NewChainVerifier(rootsFile string, logger *slog.Logger) *ChainVerifier {
+	return &ChainVerifier{RootsFile: rootsFile, Clock: time.Now, Logger: logger}
+}
+
+// Verify sets Chain on the leaf of every bundle found in certs. It only fails
+// when the roots file cannot be loaded, leaving certs untouched.
+func (v *ChainVerifier) Verify(ctx context.Context, certs []*CertInfo) []*CertError {
+	roots, errs := v.roots(ctx)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	now := v.Clock()
+	for _, bundle := range bundles(certs) {
+		leaf, status := verifyBundle(bundle, roots, now)
+		if leaf != nil {
+			leaf.Chain = &status
+		}
+	}
+	return nil
+}
+
+func (v *ChainVerifier) roots(ctx context.Context) (*x509.CertPool, []*CertError) {
+	if v.RootsFile == "" {
+		return nil, nil // VerifyOptions falls back to the system pool
+	}
+
+	certs, errs := (&FileLoader{Path: v.RootsFile, Logger: v.Logger}).LoadCertificates(ctx)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if len(certs) == 0 {
+		return nil, []*CertError{NewCertError(v.RootsFile, ErrTypePEM, fmt.Errorf("no certificate in roots file"))}
+	}
+
+	pool := x509.NewCertPool()
+	for _, ci := range certs {
+		cert, err := x509.ParseCertificate(ci.Raw)
+		if err != nil {
+			return nil, []*CertError{NewCertError(v.RootsFile, ErrTypeParse, err)}
+		}
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
+
+// bundleLabels tell apart the unrelated certs a single file may hold: the
+// entries of a Java keystore, the embedded documents of a config file and
+// the clusters and users of a kubeconfig, once per context.
+var bundleLabels = []string{AliasLabel, LocationLabel, ClusterLabel, UserLabel, ContextLabel}
+
+// bundle is the certs of one FilePath and bundleLabels values, in load order.
+type bundle struct {
+	infos []*CertInfo
+	certs []*x509.Certificate
+}
+
+func bundles(certs []*CertInfo) []*bundle {
+	var order []*bundle
+	byKey := make(map[string]*bundle)
+	for _, ci := range certs {
+		if len(ci.Raw) == 0 {
+			continue
+		}
+		cert, err := x509.ParseCertificate(ci.Raw)
+		if err != nil {
+			continue
+		}
+		key := ci.FilePath
+		for _, name := range bundleLabels {
+			key += "\x00" + ci.Labels[name]
+		}
+		b, ok := byKey[key]
+		if !ok {
+			b = &bundle{}
+			byKey[key] = b
+			order = append(order, b)
+		}
+		b.infos = append(b.infos, ci)
+		b.certs = append(b.certs, cert)
+	}
+	return order
+}
+
+// verifyBundle returns the leaf of b and whether it chains to roots.
+func verifyBundle(b *bundle, roots *x509.CertPool, now time.Time) (*CertInfo, ChainStatus) {
+	li := leafIndex(b.certs)
+	leaf := b.certs[li]
+
+	// Issuer path inside the bundle, whatever the order of the file
+	path := []*x509.Certificate{leaf}
+	for cur := leaf; ; {
+		next := -1
+		for i, c := range b.certs {
+			if !containsCert(path, c) && issuedBy(cur, c) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		cur = b.certs[next]
+		path = append(path, cur)
+	}
+
+	for _, c := range path[1:] {
+		if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+			return b.infos[li], ChainStatus{Reason: ChainExpiredIntermediate}
+		}
+	}
+
+	intermediates := x509.NewCertPool()
+	for i, c := range b.certs {
+		if i != li {
+			intermediates.AddCert(c)
+		}
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return b.infos[li], ChainStatus{Reason: classifyChainError(err, leaf, path[len(path)-1])}
+	}
+
+	for i, c := range path {
+		if i >= len(b.certs) || !b.certs[i].Equal(c) {
+			return b.infos[li], ChainStatus{Reason: ChainWrongOrder}
+		}
+	}
+	return b.infos[li], ChainStatus{Valid: true}
+}
+
+func classifyChainError(err error, leaf, top *x509.Certificate) ChainFailure {
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &invalid) && invalid.Reason == x509.Expired {
+		if invalid.Cert == nil || invalid.Cert.Equal(leaf) {
+			return ChainExpired
+		}
+		return ChainExpiredIntermediate
+	}
+	var unknown x509.UnknownAuthorityError
+	if errors.As(err, &unknown) {
+		if selfSigned(top) {
+			return ChainUnknownAuthority
+		}
+		return ChainMissingIntermediate
+	}
+	return ChainInvalid
+}
+
+// leafIndex returns the only cert of the bundle that issued none of the
+// others, falling back to the first one (e.g. a bundle of roots).
+func leafIndex(certs []*x509.Certificate) int {
+	leaf := -1
+	for i, c := range certs {
+		issuer := false
+		for j, other := range certs {
+			if i != j && issuedBy(other, c) {
+				issuer = true
+				break
+			}
+		}
+		if !issuer {
+			if leaf >= 0 {
+				return 0
+			}
+			leaf = i
+		}
+	}
+	return max(leaf, 0)
+}
+
+func issuedBy(child, parent *x509.Certificate) bool {
+	return bytes.Equal(child.RawIssuer, parent.RawSubject) && child.CheckSignatureFrom(parent) == nil
+}
+
+func selfSigned(c *x509.Certificate) bool {
+	return bytes.Equal(c.RawIssuer, c.RawSubject) &&
+		c.CheckSignature(c.SignatureAlgorithm, c.RawTBSCertificate, c.Signature) == nil
+}
+
+func containsCert(certs []*x509.Certificate, c *x509.Certificate) bool {
+	for _, x := range certs {
+		if x.Equal(c) {
+			return true
+		}
+	}
+	return false
+}
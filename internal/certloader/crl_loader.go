@@ -0,0 +1,143 @@
+package certloader
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CRLInfo describes one certificate revocation list found on disk.
+type CRLInfo struct {
+	FilePath     string
+	Issuer       string // issuer CN, or the full DN when it has no CN
+	Number       string // CRL number (decimal), empty when absent
+	ThisUpdate   time.Time
+	NextUpdate   time.Time // zero when absent
+	RevokedCount int
+
+	// Extra metric labels (source name, user-defined labels...)
+	Labels map[string]string
+}
+
+// CRLLoader loads the CRLs of a file, or of every non hidden file below a
+// directory. PEM ("X509 CRL" blocks) and DER are supported.
+type CRLLoader struct {
+	Path   string
+	Logger *slog.Logger
+}
+
+func NewCRLLoader(path string, logger *slog.Logger) *CRLLoader {
+	return &CRLLoader{
+		Path:   path,
+		Logger: logger,
+	}
+}
+
+func (l *CRLLoader) LoadCRLs(ctx context.Context) ([]*CRLInfo, []*CertError) {
+	var crls []*CRLInfo
+	var errs []*CertError
+
+	err := filepath.WalkDir(l.Path, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			errs = append(errs, NewCertError(path, ErrTypeRead, err))
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if path != l.Path && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		l.Logger.Debug("Loading CRLs from file", "path", path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, NewCertError(path, ErrTypeRead, err))
+			return nil
+		}
+		cs, es := parseCRLFile(path, data)
+		crls = append(crls, cs...)
+		errs = append(errs, es...)
+		return nil
+	})
+	// A cancelled or timed out scan is not an error, like in DirLoader
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		errs = append(errs, NewCertError(l.Path, ErrTypeUnknown, err))
+	}
+
+	return crls, errs
+}
+
+func parseCRLFile(path string, data []byte) ([]*CRLInfo, []*CertError) {
+	var crls []*CRLInfo
+	var errs []*CertError
+
+	rest := data
+	seenPEM := false
+	for len(rest) > 0 {
+		block, remaining := pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		seenPEM = true
+		rest = remaining
+
+		if block.Type != "X509 CRL" {
+			continue
+		}
+		list, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			errs = append(errs, NewCertError(path, ErrTypeParse, err))
+			continue
+		}
+		crls = append(crls, newCRLInfo(path, list))
+	}
+
+	if !seenPEM {
+		if len(data) == 0 {
+			return nil, []*CertError{NewCertError(path, ErrTypePEM, fmt.Errorf("empty file"))}
+		}
+		list, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return nil, []*CertError{NewCertError(path, ErrTypePEM, fmt.Errorf("not PEM nor DER CRL: %w", err))}
+		}
+		return []*CRLInfo{newCRLInfo(path, list)}, nil
+	}
+
+	if len(crls) == 0 && len(errs) == 0 {
+		errs = append(errs, NewCertError(path, ErrTypePEM, fmt.Errorf("no X509 CRL block")))
+	}
+	return crls, errs
+}
+
+func newCRLInfo(path string, list *x509.RevocationList) *CRLInfo {
+	issuer := list.Issuer.CommonName
+	if issuer == "" {
+		issuer = list.Issuer.String()
+	}
+	number := ""
+	if list.Number != nil {
+		number = list.Number.String()
+	}
+	return &CRLInfo{
+		FilePath:     path,
+		Issuer:       issuer,
+		Number:       number,
+		ThisUpdate:   list.ThisUpdate,
+		NextUpdate:   list.NextUpdate,
+		RevokedCount: len(list.RevokedCertificateEntries),
+	}
+}
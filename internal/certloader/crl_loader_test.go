@@ -0,0 +1,136 @@
+package certloader
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// generateTestCRL returns a DER CRL signed by ca listing revoked serials.
+func generateTestCRL(t *testing.T, ca *testIssuer, number int64, thisUpdate, nextUpdate time.Time, revoked ...int64) []byte {
+	t.Helper()
+	tmpl := &x509.RevocationList{
+		Number:     big.NewInt(number),
+		ThisUpdate: thisUpdate,
+		NextUpdate: nextUpdate,
+	}
+	for _, serial := range revoked {
+		tmpl.RevokedCertificateEntries = append(tmpl.RevokedCertificateEntries,
+			x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: thisUpdate})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, tmpl, ca.cert, ca.key)
+	if err != nil {
+		t.Fatalf("create CRL: %v", err)
+	}
+	return der
+}
+
+func TestCRLLoader_PEMAndDER(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	ca := issueTestCert(t, "Test CA", nil, true, now.Add(-time.Hour), now.Add(time.Hour))
+	other := issueTestCert(t, "Other CA", nil, true, now.Add(-time.Hour), now.Add(time.Hour))
+
+	dir := t.TempDir()
+	der := generateTestCRL(t, ca, 7, now.Add(-time.Hour), now.Add(24*time.Hour), 1, 2, 3)
+	writeFile(t, dir, "ca.crl", der)
+
+	// A PEM bundle mixing a certificate and two CRLs
+	bundle := pemBundle(ca)
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: generateTestCRL(t, other, 1, now, now.Add(time.Hour))})...)
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})...)
+	writeFile(t, dir, "bundle.pem", bundle)
+
+	crls, errs := NewCRLLoader(dir, slog.Default()).LoadCRLs(context.Background())
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(crls) != 3 {
+		t.Fatalf("expected 3 CRLs, got %d", len(crls))
+	}
+
+	// Walk order: bundle.pem before ca.crl
+	if crls[0].Issuer != "Other CA" || crls[0].RevokedCount != 0 || crls[0].Number != "1" {
+		t.Errorf("unexpected first CRL: %+v", crls[0])
+	}
+	got := crls[2]
+	if got.FilePath != filepath.Join(dir, "ca.crl") || got.Issuer != "Test CA" || got.Number != "7" || got.RevokedCount != 3 {
+		t.Errorf("unexpected DER CRL: %+v", got)
+	}
+	if !got.ThisUpdate.Equal(now.Add(-time.Hour)) || !got.NextUpdate.Equal(now.Add(24*time.Hour)) {
+		t.Errorf("unexpected update times: %s / %s", got.ThisUpdate, got.NextUpdate)
+	}
+}
+
+func TestCRLLoader_Errors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "empty.crl", nil)
+	writeFile(t, dir, "garbage.crl", []byte("garbage"))
+	writeFile(t, dir, "cert.pem", generateTestCert(t, "a", time.Now(), time.Now().Add(time.Hour)))
+	writeFile(t, dir, "broken.pem", pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: []byte("nope")}))
+	writeFile(t, dir, ".hidden.crl", []byte("garbage"))
+
+	crls, errs := NewCRLLoader(dir, slog.Default()).LoadCRLs(context.Background())
+	if len(crls) != 0 {
+		t.Fatalf("expected no CRL, got %d", len(crls))
+	}
+
+	types := make(map[string]CertErrorType)
+	for _, e := range errs {
+		types[filepath.Base(e.Path)] = e.Type
+	}
+	want := map[string]CertErrorType{
+		"empty.crl":   ErrTypePEM,
+		"garbage.crl": ErrTypePEM,
+		"cert.pem":    ErrTypePEM,
+		"broken.pem":  ErrTypeParse,
+	}
+	if len(types) != len(want) {
+		t.Fatalf("expected errors %v, got %v", want, types)
+	}
+	for name, typ := range want {
+		if types[name] != typ {
+			t.Errorf("%s: expected %s, got %s", name, typ, types[name])
+		}
+	}
+
+	_, errs = NewCRLLoader(filepath.Join(dir, "missing"), slog.Default()).LoadCRLs(context.Background())
+	if len(errs) != 1 || errs[0].Type != ErrTypeRead {
+		t.Fatalf("expected a read error, got %v", errs)
+	}
+}
+
+func TestCRLLoader_ContextCancellation(t *testing.T) {
+	now := time.Now()
+	ca := issueTestCert(t, "Test CA", nil, true, now.Add(-time.Hour), now.Add(time.Hour))
+	dir := t.TempDir()
+	writeFile(t, dir, "ca.crl", generateTestCRL(t, ca, 1, now, now.Add(time.Hour)))
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), now.Add(-time.Second))
+	defer cancel()
+
+	for name, ctx := range map[string]context.Context{"cancelled": cancelled, "deadline": expired} {
+		crls, errs := NewCRLLoader(dir, slog.Default()).LoadCRLs(ctx)
+		if len(crls) != 0 || len(errs) != 0 {
+			t.Errorf("%s: expected nothing, got %d CRLs and %v", name, len(crls), errs)
+		}
+	}
+}
+
+func TestFileLoader_SkipsDERCRL(t *testing.T) {
+	now := time.Now()
+	ca := issueTestCert(t, "Test CA", nil, true, now.Add(-time.Hour), now.Add(time.Hour))
+	path := writeFile(t, t.TempDir(), "ca.crl", generateTestCRL(t, ca, 1, now, now.Add(time.Hour)))
+
+	certs, errs := NewFileLoader(path, slog.Default()).LoadCertificates(context.Background())
+	if len(certs) != 0 || len(errs) != 0 {
+		t.Fatalf("expected a DER CRL to be skipped silently, got %d certs and %v", len(certs), errs)
+	}
+}
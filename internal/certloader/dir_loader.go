@@ -2,15 +2,70 @@ package certloader
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 type DirLoader struct {
 	Root   string
 	Logger *slog.Logger
+
+	// Optional glob patterns (filepath.Match) on file names.
+	// Empty Include means every file; Exclude wins over Include.
+	Include []string
+	Exclude []string
+
+	// Number of files parsed concurrently, 0 means one per CPU
+	Workers int
+
+	// Optional cache of parsed files, may be shared between loaders
+	Cache *ScanCache
+
+	// CacheID identifies the loader in a shared Cache, so that a full scan
+	// only prunes the entries this loader uses. Defaults to Root.
+	CacheID string
+
+	// Passwords of PKCS#12 and Java keystores. nil means the empty password
+	// for PKCS#12 and no digest check for JKS
+	Passwords *Passwords
+
+	// Embedded looks for certificates inside text documents (YAML, JSON, env,
+	// Terraform state...) instead of parsing whole files: PEM blocks anywhere
+	// and base64 DER values at DocPaths. See parseEmbedded.
+	Embedded bool
+	DocPaths []string
+
+	// PairKeys loads private keys too (.key files included, whatever
+	// Include) and pairs them with the certificates of the whole directory,
+	// see pairKeys. Orphan keys are reported as orphan_key errors.
+	PairKeys bool
+
+	// Last result of every file, so that Watch can rescan only what changed.
+	// mu also serializes full scans and rescans.
+	mu    sync.Mutex
+	files map[string]fileResult
+
+	// parseOptions of the current scan, empty when nothing may be cached
+	options string
+}
+
+type fileResult struct {
+	certs []*CertInfo
+	keys  []*KeyInfo // only with PairKeys
+	errs  []*CertError
 }
 
 func NewDirLoader(root string, logger *slog.Logger) *DirLoader {
@@ -21,12 +76,40 @@ func NewDirLoader(root string, logger *slog.Logger) *DirLoader {
 }
 
 func (l *DirLoader) LoadCertificates(ctx context.Context) ([]*CertInfo, []*CertError) {
-	var certs []*CertInfo
-	var errs []*CertError
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.options = l.parseOptions()
+	files := make(map[string]fileResult)
+	certs, errs := l.walk(ctx, l.Root, files)
+	l.files = files
+	if l.PairKeys {
+		errs = append(errs, pairKeys(certs, l.keys())...)
+	}
 
-	err := filepath.WalkDir(l.Root, func(path string, d os.DirEntry, err error) error {
+	if l.Cache != nil && l.options != "" && ctx.Err() == nil {
+		l.Cache.prune(l.cacheID(), l.options, func(path string) bool {
+			_, ok := files[path]
+			return ok
+		})
+		if err := l.Cache.Save(); err != nil {
+			l.Logger.Warn("Cannot persist scan cache", "path", l.Cache.Path, "error", err)
+		}
+	}
+
+	return certs, errs
+}
+
+// walk loads every certificate below root and records per-file results in
+// files. The tree is listed first, then files are parsed by a pool of
+// workers; results are merged back in walk order whatever the parallelism.
+func (l *DirLoader) walk(ctx context.Context, root string, files map[string]fileResult) ([]*CertInfo, []*CertError) {
+	var entries []walkEntry
+
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
-			errs = append(errs, NewCertError(path, ErrTypeRead, err))
+			entries = append(entries, walkEntry{path: path, done: true,
+				res: fileResult{errs: []*CertError{NewCertError(path, ErrTypeRead, err)}}})
 			return nil
 		}
 
@@ -50,24 +133,319 @@ func (l *DirLoader) LoadCertificates(ctx context.Context) ([]*CertInfo, []*CertE
 			return nil
 		}
 
-		// Skip private keys
+		// Private keys are only read to be paired, Include does not apply
 		if strings.HasSuffix(path, ".key") {
+			if l.PairKeys && !l.excluded(base) {
+				entries = append(entries, walkEntry{path: path})
+			}
 			return nil
 		}
 
-		// Load certificate
-		fl := NewFileLoader(path, l.Logger)
-		cs, es := fl.LoadCertificates(ctx)
-		certs = append(certs, cs...)
-		errs = append(errs, es...)
+		if !l.match(base) {
+			return nil
+		}
 
+		entries = append(entries, walkEntry{path: path})
 		return nil
 	})
 
+	l.load(ctx, entries)
+
 	// Fix: Handle both cancellation types
 	if err != nil && err != context.Canceled && err != context.DeadlineExceeded {
-		errs = append(errs, NewCertError(l.Root, ErrTypeUnknown, err))
+		entries = append(entries, walkEntry{path: root, done: true,
+			res: fileResult{errs: []*CertError{NewCertError(root, ErrTypeUnknown, err)}}})
+	}
+
+	var certs []*CertInfo
+	var errs []*CertError
+	for _, e := range entries {
+		if !e.done {
+			continue
+		}
+		r := files[e.path]
+		r.certs = append(r.certs, e.res.certs...)
+		r.keys = append(r.keys, e.res.keys...)
+		r.errs = append(r.errs, e.res.errs...)
+		files[e.path] = r
+		for _, c := range e.res.certs {
+			certs = append(certs, c.clone())
+		}
+		errs = append(errs, e.res.errs...)
+	}
+	return certs, errs
+}
+
+// walkEntry is one walked path: a file to load, or an already known error.
+type walkEntry struct {
+	path string
+	res  fileResult
+	done bool
+}
+
+// load parses pending entries with up to Workers goroutines. Entries not
+// started when ctx is done are left pending.
+func (l *DirLoader) load(ctx context.Context, entries []walkEntry) {
+	workers := l.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	workers = min(workers, len(entries))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				entries[i].res = l.loadFile(ctx, entries[i].path)
+				entries[i].done = true
+			}
+		}()
 	}
 
+feed:
+	for i := range entries {
+		if entries[i].done {
+			continue
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// loadFile parses one file, going through the cache when there is one.
+func (l *DirLoader) loadFile(ctx context.Context, path string) fileResult {
+	var stamp fileStamp
+	cacheable := false
+	if l.Cache != nil && l.options != "" {
+		// Stat before reading: a change in between only costs a future miss
+		if fi, err := os.Stat(path); err == nil {
+			stamp, cacheable = stampOf(fi), true
+			if res, ok := l.Cache.get(l.cacheID(), path, l.options, stamp); ok {
+				return res
+			}
+		}
+	}
+
+	// Load certificate
+	fl := NewFileLoader(path, l.Logger)
+	fl.Passwords = l.Passwords
+	fl.Embedded, fl.DocPaths = l.Embedded, l.DocPaths
+	fl.PairKeys = l.PairKeys
+	res := fl.load(ctx)
+
+	// A password may be fixed without touching the keystore: retry next time
+	if cacheable && ctx.Err() == nil && !hasErrorType(res.errs, ErrTypePassword) {
+		l.Cache.put(l.cacheID(), path, l.options, stamp, res)
+	}
+	return res
+}
+
+func (l *DirLoader) cacheID() string {
+	if l.CacheID != "" {
+		return l.CacheID
+	}
+	return l.Root
+}
+
+// parseOptions returns a digest of every option changing what a file parses
+// to, the passwords included, which keys cache entries. It is empty when the
+// passwords cannot be read: nothing is cached then.
+func (l *DirLoader) parseOptions() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "embedded=%t pair_keys=%t passwords=%t\n", l.Embedded, l.PairKeys, l.Passwords != nil)
+	for _, p := range l.DocPaths {
+		fmt.Fprintf(h, "doc_path=%q\n", p)
+	}
+	if l.Passwords != nil {
+		passwords, err := l.Passwords.candidates()
+		if err != nil {
+			return ""
+		}
+		for _, p := range passwords {
+			fmt.Fprintf(h, "password=%q\n", p)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func hasErrorType(errs []*CertError, t CertErrorType) bool {
+	for _, e := range errs {
+		if e.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether a file name passes the Include/Exclude filters.
+func (l *DirLoader) match(name string) bool {
+	if l.excluded(name) {
+		return false
+	}
+	if len(l.Include) == 0 {
+		return true
+	}
+	for _, pattern := range l.Include {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *DirLoader) excluded(name string) bool {
+	for _, pattern := range l.Exclude {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// keys returns the private keys of every recorded file, ordered by path.
+func (l *DirLoader) keys() []*KeyInfo {
+	var keys []*KeyInfo
+	for _, p := range slices.Sorted(maps.Keys(l.files)) {
+		keys = append(keys, l.files[p].keys...)
+	}
+	return keys
+}
+
+// === Watch ===
+
+// Watch subscribes to filesystem events below Root and, after a debounced
+// burst of events, rescans only the touched files and directories. onChange
+// receives the full merged result. Call LoadCertificates first so that
+// untouched files are known. Watch blocks until ctx is done.
+func (l *DirLoader) Watch(ctx context.Context, debounce time.Duration, onChange OnChange) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if err := l.addWatches(w, l.Root); err != nil {
+		return err
+	}
+
+	handle := func(ev fsnotify.Event) bool {
+		// inotify is not recursive: new directories need their own watch
+		if ev.Has(fsnotify.Create) {
+			if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+				if err := l.addWatches(w, ev.Name); err != nil {
+					l.Logger.Warn("Cannot watch new directory", "path", ev.Name, "error", err)
+				}
+			}
+		}
+		return true
+	}
+	flush := func(paths []string) {
+		l.Logger.Debug("Filesystem change, rescanning", "paths", paths)
+		onChange(l.rescan(ctx, paths))
+	}
+
+	return watchEvents(ctx, w, debounce, l.Logger, handle, flush)
+}
+
+// addWatches watches root and every non hidden directory below it.
+func (l *DirLoader) addWatches(w *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != l.Root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return w.Add(path)
+	})
+}
+
+// rescan reloads the given paths (files or directories, present or removed)
+// and returns the merged result of every known file.
+func (l *DirLoader) rescan(ctx context.Context, paths []string) ([]*CertInfo, []*CertError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.files == nil {
+		l.files = make(map[string]fileResult)
+	}
+	l.options = l.parseOptions()
+
+	for _, p := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// Kubernetes style "..data" symlink swaps change every file of the directory
+		if strings.HasPrefix(filepath.Base(p), "..") {
+			p = filepath.Dir(p)
+		}
+		if l.hidden(p) {
+			continue
+		}
+
+		l.forget(p)
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			continue
+		}
+		l.walk(ctx, p, l.files)
+	}
+
+	certs, errs := l.merged()
+	if l.PairKeys {
+		errs = append(errs, pairKeys(certs, l.keys())...)
+	}
+	return certs, errs
+}
+
+// hidden reports whether path sits in (or is) a hidden entry below Root.
+func (l *DirLoader) hidden(path string) bool {
+	rel, err := filepath.Rel(l.Root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// forget drops the results recorded for path and everything below it.
+func (l *DirLoader) forget(path string) {
+	prefix := path + string(filepath.Separator)
+	for p := range l.files {
+		if p == path || strings.HasPrefix(p, prefix) {
+			delete(l.files, p)
+		}
+	}
+}
+
+// merged returns copies of the recorded results, ordered by path. Callers
+// label what they get, so the recorded certs must not be handed out.
+func (l *DirLoader) merged() ([]*CertInfo, []*CertError) {
+	paths := make([]string, 0, len(l.files))
+	for p := range l.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var certs []*CertInfo
+	var errs []*CertError
+	for _, p := range paths {
+		for _, c := range l.files[p].certs {
+			certs = append(certs, c.clone())
+		}
+		errs = append(errs, l.files[p].errs...)
+	}
 	return certs, errs
 }
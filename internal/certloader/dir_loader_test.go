@@ -7,6 +7,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"fmt"
 	"log/slog"
 	"math/big"
 	"os"
@@ -294,3 +295,173 @@ func TestNewDirLoader(t *testing.T) {
 		t.Error("expected Logger to be set")
 	}
 }
+
+func TestDirLoader_IncludeExcludeFilters(t *testing.T) {
+	dir := t.TempDir()
+	logger := slog.Default()
+
+	now := time.Now()
+	for _, name := range []string{"a.pem", "b.crt", "old-c.pem", "readme.txt"} {
+		certPEM := generateTestCert(t, name, now, now.Add(365*24*time.Hour))
+		if err := os.WriteFile(filepath.Join(dir, name), certPEM, 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	loader := NewDirLoader(dir, logger)
+	loader.Include = []string{"*.pem", "*.crt"}
+	loader.Exclude = []string{"old-*"}
+	certs, errs := loader.LoadCertificates(context.Background())
+
+	if len(errs) != 0 {
+		t.Errorf("expected 0 errors, got %d: %v", len(errs), errs)
+	}
+	found := make(map[string]bool)
+	for _, c := range certs {
+		found[c.CommonName] = true
+	}
+	if len(certs) != 2 || !found["a.pem"] || !found["b.crt"] {
+		t.Fatalf("expected only a.pem and b.crt, got %v", found)
+	}
+}
+
+// waitForChange returns the first result passing ok, failing after a few seconds.
+func waitForChange(t *testing.T, ch <-chan []*CertInfo, ok func([]*CertInfo) bool) []*CertInfo {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case certs := <-ch:
+			if ok(certs) {
+				return certs
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for watch rescan")
+			return nil
+		}
+	}
+}
+
+func commonNames(certs []*CertInfo) map[string]bool {
+	cns := make(map[string]bool)
+	for _, c := range certs {
+		cns[c.CommonName] = true
+	}
+	return cns
+}
+
+func TestDirLoader_WatchRescansChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	write := func(name, cn string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), generateTestCert(t, cn, now, now.Add(time.Hour)), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	write("a.pem", "a")
+	write("b.pem", "b")
+
+	loader := NewDirLoader(dir, slog.Default())
+	if certs, _ := loader.LoadCertificates(context.Background()); len(certs) != 2 {
+		t.Fatalf("expected 2 certs, got %d", len(certs))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan []*CertInfo, 10)
+	go loader.Watch(ctx, 50*time.Millisecond, func(certs []*CertInfo, _ []*CertError) { changes <- certs })
+	time.Sleep(50 * time.Millisecond) // let the watches be installed
+
+	write("a.pem", "a2")
+	if err := os.Remove(filepath.Join(dir, "b.pem")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	write("sub/c.pem", "c")
+
+	waitForChange(t, changes, func(certs []*CertInfo) bool {
+		cns := commonNames(certs)
+		return len(certs) == 2 && cns["a2"] && cns["c"]
+	})
+
+	// Files created later in the new directory are watched too
+	write("sub/d.pem", "d")
+	waitForChange(t, changes, func(certs []*CertInfo) bool {
+		return len(certs) == 3 && commonNames(certs)["d"]
+	})
+}
+
+func TestDirLoader_WorkersDeterministicOrder(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	certPEM := generateTestCert(t, "test.example.com", now, now.Add(time.Hour))
+	for i := 0; i < 40; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("d%d", i%4))
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		name := fmt.Sprintf("cert-%02d.pem", i)
+		if err := os.WriteFile(filepath.Join(sub, name), certPEM, 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	// A broken file keeps its place among the errors
+	if err := os.WriteFile(filepath.Join(dir, "d1", "broken.pem"), []byte("nope"), 0644); err != nil {
+		t.Fatalf("failed to write broken file: %v", err)
+	}
+
+	sequential := NewDirLoader(dir, slog.Default())
+	sequential.Workers = 1
+	want, wantErrs := sequential.LoadCertificates(context.Background())
+
+	parallel := NewDirLoader(dir, slog.Default())
+	parallel.Workers = 8
+	for run := 0; run < 3; run++ {
+		got, gotErrs := parallel.LoadCertificates(context.Background())
+		if len(got) != 40 || len(gotErrs) != len(wantErrs) {
+			t.Fatalf("expected 40 certs and %d errors, got %d and %d", len(wantErrs), len(got), len(gotErrs))
+		}
+		for i := range want {
+			if got[i].FilePath != want[i].FilePath {
+				t.Fatalf("run %d: cert[%d] expected %s, got %s", run, i, want[i].FilePath, got[i].FilePath)
+			}
+		}
+	}
+}
+
+func TestDirLoader_WorkersStopOnCancel(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	certPEM := generateTestCert(t, "test.example.com", now, now.Add(time.Hour))
+	for i := 0; i < 20; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("c%02d.pem", i)), certPEM, 0644); err != nil {
+			t.Fatalf("failed to write cert: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	loader := NewDirLoader(dir, slog.Default())
+	loader.Workers = 2
+
+	// Cancel from the logger of the first parsed file
+	loader.Logger = slog.New(cancelHandler{cancel: cancel})
+	certs, _ := loader.LoadCertificates(ctx)
+
+	if len(certs) >= 20 {
+		t.Fatalf("expected cancellation to stop the workers early, got %d certs", len(certs))
+	}
+}
+
+// cancelHandler cancels a context on the first debug record.
+type cancelHandler struct{ cancel context.CancelFunc }
+
+func (h cancelHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h cancelHandler) Handle(context.Context, slog.Record) error {
+	h.cancel()
+	return nil
+}
+func (h cancelHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h cancelHandler) WithGroup(string) slog.Handler      { return h }
@@ -0,0 +1,262 @@
+package certloader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LocationLabel is the metric label holding where an embedded certificate
+// was found in its document: "line 12" or a document path like "tls.ca[0]".
+const LocationLabel = "location"
+
+var (
+	// A PEM block anywhere in a text: indented (YAML), with escaped newlines
+	// (JSON strings) or quoted line by line.
+	embeddedPEMRe = regexp.MustCompile(`-----BEGIN ([A-Z0-9# ]+)-----([\s\S]*?)-----END ([A-Z0-9# ]+)-----`)
+	base64Chars   = regexp.MustCompile(`[^A-Za-z0-9+/=]`)
+	envLineRe     = regexp.MustCompile(`^(?:export\s+)?([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+)
+
+// parseEmbedded finds the certificates embedded in a text document: every
+// PEM block wherever it stands, and base64 DER values at the given document
+// paths (see ValidateDocPath) of a YAML, JSON or env file. Each certificate is
+// labelled with its location.
+func parseEmbedded(path string, data []byte, docPaths []string, logger *slog.Logger) ([]*CertInfo, []*CertError) {
+	var certs []*CertInfo
+	var errs []*CertError
+
+	for _, m := range embeddedPEMRe.FindAllSubmatchIndex(data, -1) {
+		typ, endType := string(data[m[2]:m[3]]), string(data[m[6]:m[7]])
+		if typ != endType || (typ != "CERTIFICATE" && !slices.Contains(pkcs7PEMTypes, typ)) {
+			continue
+		}
+		loc := fmt.Sprintf("line %d", bytes.Count(data[:m[0]], []byte("\n"))+1)
+		der, err := decodeEmbeddedPEM(data[m[4]:m[5]])
+		if err != nil {
+			errs = append(errs, NewCertError(path, ErrTypeParse, fmt.Errorf("%s: %w", loc, err)))
+			continue
+		}
+		cs, es := parseCertificates(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), nil, logger)
+		certs = append(certs, locate(cs, es, loc)...)
+		errs = append(errs, es...)
+	}
+
+	if len(docPaths) == 0 {
+		return certs, errs
+	}
+	doc, ok := parseDocument(data)
+	if !ok {
+		return certs, append(errs, NewCertError(path, ErrTypeParse, errors.New("not a YAML, JSON nor env document")))
+	}
+	for _, expr := range docPaths {
+		steps, err := parseDocPath(expr)
+		if err != nil {
+			errs = append(errs, NewCertError(path, ErrTypeParse, err))
+			continue
+		}
+		walkDocPath(doc, steps, "", func(loc string, v any) {
+			s, ok := v.(string)
+			if !ok {
+				errs = append(errs, NewCertError(path, ErrTypeParse, fmt.Errorf("%s: not a string", loc)))
+				return
+			}
+			if strings.Contains(s, "-----BEGIN") {
+				return // already found by the PEM scan
+			}
+			der, err := base64.StdEncoding.DecodeString(base64Chars.ReplaceAllString(s, ""))
+			if err != nil {
+				errs = append(errs, NewCertError(path, ErrTypeParse, fmt.Errorf("%s: invalid base64: %w", loc, err)))
+				return
+			}
+			cs, es := parseCertificates(path, der, nil, logger)
+			certs = append(certs, locate(cs, es, loc)...)
+			errs = append(errs, es...)
+		})
+	}
+	return certs, errs
+}
+
+// decodeEmbeddedPEM returns the DER of a PEM body once JSON escapes,
+// indentation and quotes are stripped.
+func decodeEmbeddedPEM(body []byte) ([]byte, error) {
+	s := strings.NewReplacer(`\\n`, "", `\n`, "", `\r`, "").Replace(string(body))
+	return base64.StdEncoding.DecodeString(base64Chars.ReplaceAllString(s, ""))
+}
+
+// locate adds the location label to certs and prefixes errs with it.
+func locate(certs []*CertInfo, errs []*CertError, loc string) []*CertInfo {
+	for _, c := range certs {
+		if c.Labels == nil {
+			c.Labels = make(map[string]string, 1)
+		}
+		c.Labels[LocationLabel] = loc
+	}
+	for _, e := range errs {
+		e.Err = fmt.Errorf("%s: %w", loc, e.Err)
+	}
+	return certs
+}
+
+// parseDocument decodes YAML (JSON included) into maps and slices, or an env
+// file (KEY=value lines) into a map.
+func parseDocument(data []byte) (any, bool) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err == nil {
+		switch doc.(type) {
+		case map[string]any, []any:
+			return doc, true
+		}
+	}
+
+	env := make(map[string]any)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := envLineRe.FindStringSubmatch(line)
+		if m == nil {
+			return nil, false
+		}
+		value := m[2]
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, "'")
+		}
+		env[m[1]] = value
+	}
+	return env, len(env) > 0
+}
+
+// docStep is one step of a document path: a key, an index or a wildcard.
+type docStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// ValidateDocPath checks a document path: dotted keys with [n] indexes and *
+// wildcards, optionally starting with "$.", e.g. "$.servers[*].tls.ca".
+// Keys holding dots are written ['tls.crt']. In env files the path is the
+// variable name.
+func ValidateDocPath(expr string) error {
+	_, err := parseDocPath(expr)
+	return err
+}
+
+func parseDocPath(expr string) ([]docStep, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(expr, "$"), ".")
+	if s == "" {
+		return nil, fmt.Errorf("invalid document path %q: empty", expr)
+	}
+
+	var steps []docStep
+	for s != "" {
+		switch {
+		case strings.HasPrefix(s, "['"):
+			end := strings.Index(s, "']")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid document path %q: unterminated ['", expr)
+			}
+			steps = append(steps, docStep{key: s[2:end]})
+			s = s[end+2:]
+		case strings.HasPrefix(s, "["):
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid document path %q: unterminated [", expr)
+			}
+			if s[1:end] == "*" {
+				steps = append(steps, docStep{wildcard: true})
+			} else {
+				n, err := strconv.Atoi(s[1:end])
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid document path %q: bad index %q", expr, s[1:end])
+				}
+				steps = append(steps, docStep{index: n, isIndex: true})
+			}
+			s = s[end+1:]
+		default:
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid document path %q: empty key", expr)
+			}
+			if key := s[:end]; key == "*" {
+				steps = append(steps, docStep{wildcard: true})
+			} else {
+				steps = append(steps, docStep{key: key})
+			}
+			s = s[end:]
+		}
+		if strings.HasPrefix(s, ".") {
+			s = s[1:]
+			if s == "" {
+				return nil, fmt.Errorf("invalid document path %q: trailing dot", expr)
+			}
+		}
+	}
+	return steps, nil
+}
+
+// walkDocPath calls visit with every value steps lead to and its concrete
+// location. Missing keys and indexes are skipped silently.
+func walkDocPath(node any, steps []docStep, loc string, visit func(loc string, v any)) {
+	if len(steps) == 0 {
+		visit(loc, node)
+		return
+	}
+	step, rest := steps[0], steps[1:]
+
+	switch n := node.(type) {
+	case map[string]any:
+		if step.isIndex {
+			return
+		}
+		if step.wildcard {
+			for _, k := range slices.Sorted(maps.Keys(n)) {
+				walkDocPath(n[k], rest, joinDocKey(loc, k), visit)
+			}
+			return
+		}
+		if v, ok := n[step.key]; ok {
+			walkDocPath(v, rest, joinDocKey(loc, step.key), visit)
+		}
+	case []any:
+		switch {
+		case step.wildcard:
+			for i, v := range n {
+				walkDocPath(v, rest, fmt.Sprintf("%s[%d]", loc, i), visit)
+			}
+		case step.isIndex && step.index < len(n):
+			walkDocPath(n[step.index], rest, fmt.Sprintf("%s[%d]", loc, step.index), visit)
+		}
+	}
+}
+
+func joinDocKey(loc, key string) string {
+	if strings.ContainsAny(key, ".[]") {
+		return loc + "['" + key + "']"
+	}
+	if loc == "" {
+		return key
+	}
+	return loc + "." + key
+}
@@ -0,0 +1,166 @@
+package certloader
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(strings.TrimSpace(s), "\n", "\n"+prefix)
+}
+
+func TestFileLoader_Embedded(t *testing.T) {
+	now := time.Now()
+	web := string(generateTestCert(t, "web", now, now.Add(time.Hour)))
+	ca := base64.StdEncoding.EncodeToString(generateTestCertDER(t, "ca", now, now.Add(time.Hour)))
+	node1 := base64.StdEncoding.EncodeToString(generateTestCertDER(t, "node-1", now, now.Add(time.Hour)))
+	node2 := base64.StdEncoding.EncodeToString(generateTestCertDER(t, "node-2", now, now.Add(time.Hour)))
+	escaped, _ := json.Marshal(web)
+
+	tests := []struct {
+		name     string
+		content  string
+		docPaths []string
+		want     []string // common name @ location
+	}{
+		{
+			name: "helm values",
+			content: "ingress:\n  enabled: true\n  tls:\n    cert: |\n" + indent(web, "      ") +
+				"\n    ca: " + ca +
+				"\nservers:\n  - {name: a, cert: " + node1 + "}\n  - {name: b, cert: " + node2 + "}\n",
+			docPaths: []string{"ingress.tls.ca", "$.servers[*].cert", "ingress.tls.cert"},
+			want:     []string{"web@line 5", "ca@ingress.tls.ca", "node-1@servers[0].cert", "node-2@servers[1].cert"},
+		},
+		{
+			name:    "terraform state",
+			content: `{"version": 4, "resources": [{"instances": [{"attributes": {"cert_pem": ` + string(escaped) + `}}]}]}`,
+			want:    []string{"web@line 1"},
+		},
+		{
+			name:     "env file",
+			content:  "# generated\nexport API_URL=https://api\nCA_CERT=\"" + ca + "\"\nTLS_CERT='" + node1 + "'\n",
+			docPaths: []string{"CA_CERT", "TLS_CERT", "MISSING"},
+			want:     []string{"ca@CA_CERT", "node-1@TLS_CERT"},
+		},
+		{
+			name:     "dotted key",
+			content:  `{"data": {"tls.crt": "` + node2 + `"}}`,
+			docPaths: []string{"data['tls.crt']"},
+			want:     []string{"node-2@data['tls.crt']"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewFileLoader(writeFile(t, t.TempDir(), "doc", []byte(tc.content)), slog.Default())
+			l.Embedded, l.DocPaths = true, tc.docPaths
+
+			certs, errs := l.LoadCertificates(context.Background())
+			if len(errs) != 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			var got []string
+			for _, c := range certs {
+				got = append(got, c.CommonName+"@"+c.Labels[LocationLabel])
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFileLoader_EmbeddedErrors(t *testing.T) {
+	content := "a:\n  cert: not-base64!\n  num: 3\n  other: aGVsbG8=\n"
+	l := NewFileLoader(writeFile(t, t.TempDir(), "values.yaml", []byte(content)), slog.Default())
+	l.Embedded, l.DocPaths = true, []string{"a.cert", "a.num", "a.other"}
+
+	certs, errs := l.LoadCertificates(context.Background())
+	if len(certs) != 0 || len(errs) != 3 {
+		t.Fatalf("expected 3 errors, got %d certs and %v", len(certs), errs)
+	}
+	for i, want := range []string{"a.cert: invalid base64", "a.num: not a string", "a.other: not PEM nor DER"} {
+		if !strings.Contains(errs[i].Error(), want) {
+			t.Errorf("error %d: expected %q, got %v", i, want, errs[i])
+		}
+	}
+
+	// Without any recognisable document, paths cannot be looked up
+	l = NewFileLoader(writeFile(t, t.TempDir(), "script.sh", []byte("#!/bin/sh\necho hi\n")), slog.Default())
+	l.Embedded, l.DocPaths = true, []string{"a"}
+	if _, errs := l.LoadCertificates(context.Background()); len(errs) != 1 || errs[0].Type != ErrTypeParse {
+		t.Errorf("expected a parse_error, got %v", errs)
+	}
+}
+
+func TestDirLoader_EmbeddedLocationCached(t *testing.T) {
+	now := time.Now()
+	dir := t.TempDir()
+	writeFile(t, dir, "values.yaml", []byte("tls:\n  cert: |\n"+indent(string(generateTestCert(t, "web", now, now.Add(time.Hour))), "    ")))
+
+	cache, _ := NewScanCache("")
+	l := NewDirLoader(dir, slog.Default())
+	l.Cache, l.Embedded = cache, true
+
+	for i := 0; i < 2; i++ {
+		certs, errs := l.LoadCertificates(context.Background())
+		if len(errs) != 0 || len(certs) != 1 || certs[0].Labels[LocationLabel] != "line 3" {
+			t.Fatalf("scan %d: expected web at line 3, got %v and %v", i, certs, errs)
+		}
+	}
+	if s := cache.Stats(); s.Hits != 1 {
+		t.Errorf("expected the second scan to hit the cache, got %+v", s)
+	}
+}
+
+func TestDirLoader_EmbeddedOptionsChangeCache(t *testing.T) {
+	now := time.Now()
+	ca := base64.StdEncoding.EncodeToString(generateTestCertDER(t, "ca", now, now.Add(time.Hour)))
+	dir := t.TempDir()
+	writeFile(t, dir, "values.yaml", []byte("tls:\n  ca: "+ca+"\n"))
+
+	cache, _ := NewScanCache("")
+	l := NewDirLoader(dir, slog.Default())
+	l.Cache, l.Embedded = cache, true
+
+	// No PEM block and no doc path: nothing found, and cached as such
+	if certs, _ := l.LoadCertificates(context.Background()); len(certs) != 0 {
+		t.Fatalf("expected no cert without doc paths, got %v", commonNames(certs))
+	}
+
+	// The file is untouched, the new option still applies
+	l.DocPaths = []string{"tls.ca"}
+	certs, errs := l.LoadCertificates(context.Background())
+	if len(errs) != 0 || len(certs) != 1 || certs[0].Labels[LocationLabel] != "tls.ca" {
+		t.Fatalf("expected ca at tls.ca once doc paths are set, got %v and %v", commonNames(certs), errs)
+	}
+	if s := cache.Stats(); s.Hits != 0 || s.Entries != 1 {
+		t.Errorf("expected the old entry to be replaced, got %+v", s)
+	}
+
+	if certs, _ := l.LoadCertificates(context.Background()); len(certs) != 1 {
+		t.Errorf("expected the cached ca, got %v", commonNames(certs))
+	}
+	if s := cache.Stats(); s.Hits != 1 {
+		t.Errorf("expected the new options to hit, got %+v", s)
+	}
+}
+
+func TestValidateDocPath(t *testing.T) {
+	for _, expr := range []string{"a", "$.a.b", "a[0].b", "a[*]", "*.cert", "data['tls.crt']", "ENV_VAR"} {
+		if err := ValidateDocPath(expr); err != nil {
+			t.Errorf("%q: unexpected error %v", expr, err)
+		}
+	}
+	for _, expr := range []string{"", "$", "a.", "a..b", "a[x]", "a[-1]", "a[0", "a['b"} {
+		if err := ValidateDocPath(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
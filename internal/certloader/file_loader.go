@@ -8,11 +8,32 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 type FileLoader struct {
 	Path   string
 	Logger *slog.Logger
+
+	// Passwords of PKCS#12 and Java keystores. nil means the empty password
+	// for PKCS#12 and no digest check for JKS
+	Passwords *Passwords
+
+	// Embedded looks for certificates inside text documents (YAML, JSON, env,
+	// Terraform state...) instead of parsing whole files: PEM blocks anywhere
+	// and base64 DER values at DocPaths. See parseEmbedded.
+	Embedded bool
+	DocPaths []string
+
+	// PairKeys reads private keys too, from the file itself and from its
+	// conventional key file (tls.crt -> tls.key...), and sets CertInfo.Key.
+	// See pairKeys.
+	PairKeys bool
 }
 
 func NewFileLoader(path string, logger *slog.Logger) *FileLoader {
@@ -23,9 +44,21 @@ func NewFileLoader(path string, logger *slog.Logger) *FileLoader {
 }
 
 func (l *FileLoader) LoadCertificates(ctx context.Context) ([]*CertInfo, []*CertError) {
+	res := l.load(ctx)
+	if !l.PairKeys || len(res.certs) == 0 {
+		return res.certs, res.errs
+	}
+
+	keys, errs := readSiblingKeys(l.Path)
+	pairKeys(res.certs, append(res.keys, keys...))
+	return res.certs, append(res.errs, errs...)
+}
+
+// load reads and parses the file, private keys included when PairKeys is set.
+func (l *FileLoader) load(ctx context.Context) fileResult {
 	select {
 	case <-ctx.Done():
-		return nil, []*CertError{NewCertError(l.Path, ErrTypeUnknown, ctx.Err())}
+		return fileResult{errs: []*CertError{NewCertError(l.Path, ErrTypeUnknown, ctx.Err())}}
 	default:
 	}
 
@@ -33,15 +66,37 @@ func (l *FileLoader) LoadCertificates(ctx context.Context) ([]*CertInfo, []*Cert
 
 	f, err := os.Open(l.Path)
 	if err != nil {
-		return nil, []*CertError{NewCertError(l.Path, ErrTypeRead, err)}
+		return fileResult{errs: []*CertError{NewCertError(l.Path, ErrTypeRead, err)}}
 	}
 	defer f.Close()
 
 	data, err := io.ReadAll(f)
 	if err != nil {
-		return nil, []*CertError{NewCertError(l.Path, ErrTypeRead, err)}
+		return fileResult{errs: []*CertError{NewCertError(l.Path, ErrTypeRead, err)}}
 	}
 
+	if l.Embedded {
+		cs, es := parseEmbedded(l.Path, data, l.DocPaths, l.Logger)
+		return fileResult{certs: cs, errs: es}
+	}
+	cs, es := parseCertificates(l.Path, data, l.Passwords, l.Logger)
+	res := fileResult{certs: cs, errs: es}
+	if l.PairKeys {
+		keys, kerrs := parsePrivateKeys(l.Path, data)
+		if len(keys) > 0 && len(cs) == 0 {
+			// A DER key is "not PEM nor DER X.509", which is expected here
+			res.errs = slices.DeleteFunc(res.errs, func(e *CertError) bool { return e.Type == ErrTypePEM })
+		}
+		res.keys = keys
+		res.errs = append(res.errs, kerrs...)
+	}
+	return res
+}
+
+// parseCertificates decodes every certificate of data, whatever its format:
+// PEM (certificates and PKCS#7 blocks), DER, PKCS#7, JKS/JCEKS or PKCS#12.
+// path is only used to report the certificates and errors.
+func parseCertificates(path string, data []byte, passwords *Passwords, logger *slog.Logger) ([]*CertInfo, []*CertError) {
 	var certs []*CertInfo
 	var errs []*CertError
 
@@ -62,23 +117,28 @@ func (l *FileLoader) LoadCertificates(ctx context.Context) ([]*CertInfo, []*Cert
 		seenPEM = true
 		rest = remaining
 
+		if slices.Contains(pkcs7PEMTypes, block.Type) {
+			p7, err := decodePKCS7(block.Bytes)
+			if err != nil {
+				errs = append(errs, NewCertError(path, ErrTypeParse, err))
+				continue
+			}
+			for _, cert := range p7 {
+				certs = append(certs, newCertInfo(path, cert))
+			}
+			continue
+		}
+
 		if block.Type != "CERTIFICATE" {
 			continue
 		}
 
 		cert, err := x509.ParseCertificate(block.Bytes)
 		if err != nil {
-			errs = append(errs, NewCertError(l.Path, ErrTypeParse, err))
+			errs = append(errs, NewCertError(path, ErrTypeParse, err))
 			continue
 		}
-		info := &CertInfo{
-			FilePath:   l.Path,
-			CommonName: cert.Subject.CommonName,
-			Issuer:     cert.Issuer.CommonName,
-			NotBefore:  cert.NotBefore,
-			NotAfter:   cert.NotAfter,
-		}
-		certs = append(certs, info)
+		certs = append(certs, newCertInfo(path, cert))
 
 	}
 
@@ -86,30 +146,96 @@ func (l *FileLoader) LoadCertificates(ctx context.Context) ([]*CertInfo, []*Cert
 	if !seenPEM {
 		if len(data) == 0 {
 			return nil, []*CertError{
-				NewCertError(l.Path, ErrTypePEM, fmt.Errorf("empty file")),
+				NewCertError(path, ErrTypePEM, fmt.Errorf("empty file")),
 			}
 		}
 
-		l.Logger.Debug("No PEM found, trying DER", "path", l.Path)
+		logger.Debug("No PEM found, trying DER", "path", path)
+
+		// Java keystores (JKS, JCEKS, cacerts): one label per alias
+		if isJKS(data) {
+			logger.Debug("Decoding Java keystore", "path", path)
+			entries, errs := decodeJKS(path, data, passwords)
+			for _, e := range entries {
+				for _, cert := range e.certs {
+					info := newCertInfo(path, cert)
+					info.Labels = map[string]string{AliasLabel: e.alias}
+					certs = append(certs, info)
+				}
+			}
+			return certs, errs
+		}
+
+		// PKCS#7 bundles (.p7b, .p7c)
+		if isPKCS7(data) {
+			logger.Debug("Decoding PKCS#7 bundle", "path", path)
+			p7, err := decodePKCS7(data)
+			if err != nil {
+				return nil, []*CertError{NewCertError(path, ErrTypeParse, err)}
+			}
+			for _, cert := range p7 {
+				certs = append(certs, newCertInfo(path, cert))
+			}
+			return certs, nil
+		}
+
+		// PKCS#12 keystores (.p12, .pfx) are DER too
+		if isPKCS12(data) {
+			logger.Debug("Decoding PKCS#12 keystore", "path", path)
+			p12, cerr := decodePKCS12(path, data, passwords)
+			if cerr != nil {
+				return nil, []*CertError{cerr}
+			}
+			for _, cert := range p12 {
+				certs = append(certs, newCertInfo(path, cert))
+			}
+			return certs, nil
+		}
 
 		// Try DER
 		cert, err := x509.ParseCertificate(data)
 		if err != nil {
+			// A DER CRL next to the certificates is not an error, see CRLLoader
+			if _, crlErr := x509.ParseRevocationList(data); crlErr == nil {
+				logger.Debug("Skipping DER CRL", "path", path)
+				return nil, nil
+			}
 			return nil, []*CertError{
-				NewCertError(l.Path, ErrTypePEM, fmt.Errorf("not PEM nor DER X.509: %w", err)),
+				NewCertError(path, ErrTypePEM, fmt.Errorf("not PEM nor DER X.509: %w", err)),
 			}
 		}
 
 		// DER Success
-		info := &CertInfo{
-			FilePath:   l.Path,
-			CommonName: cert.Subject.CommonName,
-			Issuer:     cert.Issuer.CommonName,
-			NotBefore:  cert.NotBefore,
-			NotAfter:   cert.NotAfter,
-		}
-		return []*CertInfo{info}, nil
+		return []*CertInfo{newCertInfo(path, cert)}, nil
 	}
 
 	return certs, errs
 }
+
+// Watch reloads the file whenever it changes, until ctx is done. The parent
+// directory is watched so that atomic renames (Vault Agent, certbot) and
+// Kubernetes "..data" symlink swaps are seen too.
+func (l *FileLoader) Watch(ctx context.Context, debounce time.Duration, onChange OnChange) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if err := w.Add(filepath.Dir(l.Path)); err != nil {
+		return err
+	}
+
+	target := filepath.Clean(l.Path)
+	handle := func(ev fsnotify.Event) bool {
+		name := filepath.Clean(ev.Name)
+		return name == target || strings.HasPrefix(filepath.Base(name), "..") ||
+			(l.PairKeys && slices.Contains(siblingKeyPaths(target), name))
+	}
+	flush := func([]string) {
+		l.Logger.Debug("Filesystem change, reloading", "path", l.Path)
+		onChange(l.LoadCertificates(ctx))
+	}
+
+	return watchEvents(ctx, w, debounce, l.Logger, handle, flush)
+}
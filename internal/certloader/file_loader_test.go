@@ -240,3 +240,33 @@ func TestFileLoader_ContextCancelled(t *testing.T) {
 		t.Fatalf("expected ErrTypeUnknown, got %s", errs[0].Type)
 	}
 }
+
+func TestFileLoader_WatchAtomicRename(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	der := generateTestCertDER(t, "old.example.com", now, now.Add(time.Hour))
+	path := writeFile(t, dir, "cert.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan []*CertInfo, 10)
+	fl := NewFileLoader(path, slog.Default())
+	go fl.Watch(ctx, 50*time.Millisecond, func(certs []*CertInfo, _ []*CertError) { changes <- certs })
+	time.Sleep(50 * time.Millisecond) // let the watch be installed
+
+	// Renewal the way Vault Agent does it: write aside, then rename over
+	der = generateTestCertDER(t, "new.example.com", now, now.Add(time.Hour))
+	tmp := writeFile(t, dir, ".cert.pem.tmp", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+
+	select {
+	case certs := <-changes:
+		if len(certs) != 1 || certs[0].CommonName != "new.example.com" {
+			t.Fatalf("expected renewed cert, got %+v", certs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for watch reload")
+	}
+}
@@ -0,0 +1,179 @@
+package certloader
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// AliasLabel is the metric label holding the alias of a Java keystore entry.
+const AliasLabel = "alias"
+
+const (
+	jksMagic   = 0xfeedfeed
+	jceksMagic = 0xcececece
+
+	jksPrivateKeyEntry  = 1
+	jksTrustedCertEntry = 2
+	jksSecretKeyEntry   = 3 // JCEKS only, a serialized Java object
+)
+
+// jksEntry is one alias of a Java keystore and its certificates, leaf first.
+type jksEntry struct {
+	alias string
+	certs []*x509.Certificate
+}
+
+func isJKS(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	magic := binary.BigEndian.Uint32(data)
+	return magic == jksMagic || magic == jceksMagic
+}
+
+// decodeJKS returns the trusted certificate and private key entries of a JKS
+// or JCEKS keystore. Certificates are stored in clear, so no password is
+// needed to list them; when passwords are configured the keystore digest is
+// checked and a mismatch is reported as ErrTypePassword. JCEKS secret key
+// entries are serialized Java objects with no length prefix, so decoding
+// stops at the first one: the entries before it are returned and the ones
+// after it are reported as not listed.
+func decodeJKS(path string, data []byte, passwords *Passwords) ([]jksEntry, []*CertError) {
+	if passwords != nil {
+		if cerr := checkJKSDigest(path, data, passwords); cerr != nil {
+			return nil, []*CertError{cerr}
+		}
+	}
+
+	r := &jksReader{data: data}
+	magic := r.uint32()
+	version := r.uint32()
+	count := r.uint32()
+	if r.err == nil && version != 1 && version != 2 {
+		r.err = fmt.Errorf("unsupported keystore version %d", version)
+	}
+	if r.err != nil {
+		return nil, []*CertError{NewCertError(path, ErrTypeParse, r.err)}
+	}
+
+	var entries []jksEntry
+	for i := uint32(0); i < count; i++ {
+		tag := r.uint32()
+		alias := r.utf()
+		r.skip(8) // creation date
+
+		var entry jksEntry
+		switch tag {
+		case jksPrivateKeyEntry:
+			r.skip(int(r.uint32())) // encrypted key
+			n := r.uint32()
+			for j := uint32(0); j < n && r.err == nil; j++ {
+				entry.certs = append(entry.certs, r.cert(version))
+			}
+		case jksTrustedCertEntry:
+			entry.certs = append(entry.certs, r.cert(version))
+		case jksSecretKeyEntry:
+			if magic == jceksMagic {
+				r.err = fmt.Errorf("entry %q: JCEKS secret key entries are not supported, %d later entries not listed", alias, count-i-1)
+				break
+			}
+			fallthrough
+		default:
+			r.err = fmt.Errorf("entry %q: unknown entry tag %d", alias, tag)
+		}
+		if r.err != nil {
+			return entries, []*CertError{NewCertError(path, ErrTypeParse, r.err)}
+		}
+		entry.alias = alias
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// checkJKSDigest verifies the trailing SHA-1 of the keystore, computed over
+// the UTF-16 password, the "Mighty Aphrodite" salt and the entries.
+func checkJKSDigest(path string, data []byte, passwords *Passwords) *CertError {
+	if len(data) < sha1.Size {
+		return NewCertError(path, ErrTypeParse, errors.New("keystore too short"))
+	}
+	candidates, err := passwords.candidates()
+	if err != nil {
+		return NewCertError(path, ErrTypePassword, err)
+	}
+
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	for _, password := range candidates {
+		h := sha1.New()
+		for _, c := range utf16.Encode([]rune(password)) {
+			h.Write([]byte{byte(c >> 8), byte(c)})
+		}
+		h.Write([]byte("Mighty Aphrodite"))
+		h.Write(body)
+		if bytes.Equal(h.Sum(nil), digest) {
+			return nil
+		}
+	}
+	return NewCertError(path, ErrTypePassword,
+		fmt.Errorf("none of %d password(s) matches the keystore digest", len(candidates)))
+}
+
+// jksReader decodes the big-endian Java DataOutputStream encoding. The first
+// error sticks and makes every later read a no-op.
+type jksReader struct {
+	data []byte
+	err  error
+}
+
+func (r *jksReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = errors.New("truncated keystore")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *jksReader) skip(n int) { r.next(n) }
+
+func (r *jksReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// utf reads a length-prefixed modified UTF-8 string. Aliases are plain
+// strings in practice, so it is taken as regular UTF-8.
+func (r *jksReader) utf() string {
+	b := r.next(2)
+	if b == nil {
+		return ""
+	}
+	return string(r.next(int(binary.BigEndian.Uint16(b))))
+}
+
+func (r *jksReader) cert(version uint32) *x509.Certificate {
+	if version == 2 {
+		if typ := r.utf(); r.err == nil && typ != "X.509" {
+			r.err = fmt.Errorf("unsupported certificate type %q", typ)
+		}
+	}
+	der := r.next(int(r.uint32()))
+	if r.err != nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		r.err = err
+	}
+	return cert
+}
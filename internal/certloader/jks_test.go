@@ -0,0 +1,150 @@
+package certloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+type testJKSEntry struct {
+	tag   uint32
+	alias string
+	certs []*x509.Certificate
+}
+
+// encodeTestJKS writes a version 2 keystore the way keytool does. Private
+// keys are never decoded, so random bytes stand for them.
+func encodeTestJKS(t *testing.T, magic uint32, password string, entries ...testJKSEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	u32 := func(v uint32) { _ = binary.Write(&buf, binary.BigEndian, v) }
+	utf := func(s string) {
+		_ = binary.Write(&buf, binary.BigEndian, uint16(len(s)))
+		buf.WriteString(s)
+	}
+	cert := func(c *x509.Certificate) {
+		utf("X.509")
+		u32(uint32(len(c.Raw)))
+		buf.Write(c.Raw)
+	}
+
+	u32(magic)
+	u32(2)
+	u32(uint32(len(entries)))
+	for _, e := range entries {
+		u32(e.tag)
+		utf(e.alias)
+		_ = binary.Write(&buf, binary.BigEndian, uint64(time.Now().UnixMilli()))
+		switch e.tag {
+		case jksPrivateKeyEntry:
+			u32(16)
+			buf.Write(make([]byte, 16))
+			u32(uint32(len(e.certs)))
+			for _, c := range e.certs {
+				cert(c)
+			}
+		case jksTrustedCertEntry:
+			cert(e.certs[0])
+		default:
+			buf.Write([]byte{0xac, 0xed, 0x00, 0x05}) // start of a serialized object
+		}
+	}
+
+	h := sha1.New()
+	for _, c := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(buf.Bytes())
+	buf.Write(h.Sum(nil))
+	return buf.Bytes()
+}
+
+func TestFileLoader_JKS(t *testing.T) {
+	now := time.Now()
+	ca := issueTestCert(t, "Kafka CA", nil, true, now.Add(-time.Hour), now.Add(time.Hour))
+	broker := issueTestCert(t, "broker-1", ca, false, now.Add(-time.Hour), now.Add(time.Hour))
+	data := encodeTestJKS(t, jksMagic, "changeit",
+		testJKSEntry{jksTrustedCertEntry, "kafka-ca", []*x509.Certificate{ca.cert}},
+		testJKSEntry{jksPrivateKeyEntry, "broker", []*x509.Certificate{broker.cert, ca.cert}},
+	)
+	path := writeFile(t, t.TempDir(), "kafka.keystore.jks", data)
+
+	for name, passwords := range map[string]*Passwords{
+		"without password": nil,
+		"right password":   {List: []string{"secret", "changeit"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			l := NewFileLoader(path, slog.Default())
+			l.Passwords = passwords
+
+			certs, errs := l.LoadCertificates(context.Background())
+			if len(errs) != 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			var got []string
+			for _, c := range certs {
+				got = append(got, c.Labels[AliasLabel]+"/"+c.CommonName)
+			}
+			want := []string{"kafka-ca/Kafka CA", "broker/broker-1", "broker/Kafka CA"}
+			if len(got) != len(want) {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("entry %d: expected %s, got %s", i, want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFileLoader_JKSWrongPassword(t *testing.T) {
+	now := time.Now()
+	ca := issueTestCert(t, "CA", nil, true, now.Add(-time.Hour), now.Add(time.Hour))
+	data := encodeTestJKS(t, jksMagic, "changeit", testJKSEntry{jksTrustedCertEntry, "ca", []*x509.Certificate{ca.cert}})
+
+	l := NewFileLoader(writeFile(t, t.TempDir(), "cacerts", data), slog.Default())
+	l.Passwords = &Passwords{List: []string{"nope"}}
+	certs, errs := l.LoadCertificates(context.Background())
+	if len(certs) != 0 || len(errs) != 1 || errs[0].Type != ErrTypePassword {
+		t.Fatalf("expected a single password_error, got %d certs and %v", len(certs), errs)
+	}
+}
+
+func TestFileLoader_JCEKSSecretKey(t *testing.T) {
+	now := time.Now()
+	ca := issueTestCert(t, "CA", nil, true, now.Add(-time.Hour), now.Add(time.Hour))
+	leaf := issueTestCert(t, "leaf", ca, false, now.Add(-time.Hour), now.Add(time.Hour))
+	data := encodeTestJKS(t, jceksMagic, "",
+		testJKSEntry{jksTrustedCertEntry, "ca", []*x509.Certificate{ca.cert}},
+		testJKSEntry{jksSecretKeyEntry, "aes", nil},
+		testJKSEntry{jksPrivateKeyEntry, "leaf", []*x509.Certificate{leaf.cert, ca.cert}},
+	)
+
+	certs, errs := NewFileLoader(writeFile(t, t.TempDir(), "store.jceks", data), slog.Default()).LoadCertificates(context.Background())
+	if len(certs) != 1 || certs[0].Labels[AliasLabel] != "ca" {
+		t.Fatalf("expected the entry before the secret key, got %v", commonNames(certs))
+	}
+	if len(errs) != 1 || errs[0].Type != ErrTypeParse || !strings.Contains(errs[0].Error(), `entry "aes": JCEKS secret key entries are not supported, 1 later entries not listed`) {
+		t.Fatalf("expected a parse_error for the secret key, got %v", errs)
+	}
+}
+
+func TestDecodeJKS_Truncated(t *testing.T) {
+	now := time.Now()
+	ca := issueTestCert(t, "CA", nil, true, now.Add(-time.Hour), now.Add(time.Hour))
+	data := encodeTestJKS(t, jksMagic, "", testJKSEntry{jksTrustedCertEntry, "ca", []*x509.Certificate{ca.cert}})
+
+	entries, errs := decodeJKS("x", data[:40], nil)
+	if len(entries) != 0 || len(errs) != 1 || errs[0].Type != ErrTypeParse {
+		t.Fatalf("expected a parse_error, got %v and %v", entries, errs)
+	}
+}
@@ -0,0 +1,228 @@
+package certloader
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeyFailure tells why a certificate has no matching private key.
+type KeyFailure string
+
+const (
+	KeyMismatch KeyFailure = "mismatch" // a key sits next to the certificate but does not match it
+	KeyMissing  KeyFailure = "missing"  // no key in the file, next to it, nor anywhere in the source
+)
+
+// KeyStatus is set on certificates when keys are paired (FileLoader.PairKeys,
+// DirLoader.PairKeys): on every certificate a key matches, and on the leaf of
+// every other file unless it is a CA.
+type KeyStatus struct {
+	Match   bool
+	Reason  KeyFailure // empty when matched
+	KeyPath string     // matching key, or the mismatched one; empty when missing
+}
+
+// KeyInfo is a private key found while scanning, reduced to what pairing
+// needs. Keys are never reported on their own.
+type KeyInfo struct {
+	FilePath        string `json:"path"`
+	PublicKeySHA256 string `json:"pub"` // same as CertInfo.PublicKeySHA256 for the matching cert
+}
+
+// privateKeyPEMTypes are the PEM blocks holding a clear private key: PKCS#8,
+// then PKCS#1 and SEC 1.
+var privateKeyPEMTypes = map[string]func([]byte) (any, error){
+	"PRIVATE KEY":     x509.ParsePKCS8PrivateKey,
+	"RSA PRIVATE KEY": func(der []byte) (any, error) { return x509.ParsePKCS1PrivateKey(der) },
+	"EC PRIVATE KEY":  func(der []byte) (any, error) { return x509.ParseECPrivateKey(der) },
+}
+
+// parsePrivateKeys returns the private keys of data: PEM blocks, or a whole
+// DER key. Encrypted keys cannot be paired and are skipped.
+func parsePrivateKeys(path string, data []byte) ([]*KeyInfo, []*CertError) {
+	var keys []*KeyInfo
+	var errs []*CertError
+
+	rest := data
+	seenPEM := false
+	for {
+		block, remaining := pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		seenPEM = true
+		rest = remaining
+
+		parse, ok := privateKeyPEMTypes[block.Type]
+		if !ok || strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+			continue
+		}
+		key, err := parse(block.Bytes)
+		if err != nil {
+			errs = append(errs, NewCertError(path, ErrTypeParse, fmt.Errorf("private key: %w", err)))
+			continue
+		}
+		if k, err := newKeyInfo(path, key); err == nil {
+			keys = append(keys, k)
+		}
+	}
+	if seenPEM {
+		return keys, errs
+	}
+
+	// DER keys are recognised by content only, anything else is not an error
+	for _, parse := range privateKeyPEMTypes {
+		if key, err := parse(data); err == nil {
+			if k, err := newKeyInfo(path, key); err == nil {
+				return []*KeyInfo{k}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func newKeyInfo(path string, key any) (*KeyInfo, error) {
+	priv, ok := key.(interface{ Public() crypto.PublicKey })
+	if !ok {
+		return nil, errors.New("no public key")
+	}
+	spki, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(spki)
+	return &KeyInfo{FilePath: path, PublicKeySHA256: hex.EncodeToString(sum[:])}, nil
+}
+
+// keyFileNames returns the names the private key of certificate file name is
+// conventionally stored under: tls.crt -> tls.key, server.pem ->
+// server.key, server.key.pem, server-key.pem; server-cert.pem ->
+// server-key.pem; certbot cert.pem and fullchain.pem -> privkey.pem.
+func keyFileNames(name string) []string {
+	switch name {
+	case "cert.pem", "fullchain.pem":
+		return []string{"privkey.pem"}
+	}
+
+	stem := name
+	for _, ext := range []string{".crt.pem", ".cert.pem", ".crt", ".cer", ".cert", ".pem"} {
+		if strings.HasSuffix(stem, ext) {
+			stem = strings.TrimSuffix(stem, ext)
+			break
+		}
+	}
+	if stem == name || stem == "" {
+		return nil
+	}
+
+	names := []string{stem + ".key", stem + ".key.pem", stem + "-key.pem", stem + "_key.pem"}
+	for _, suffix := range []string{"-cert", "_cert", "-crt", "_crt", ".cert"} {
+		if trimmed := strings.TrimSuffix(stem, suffix); trimmed != stem && trimmed != "" {
+			sep := suffix[:1]
+			names = append(names, trimmed+".key", trimmed+sep+"key.pem", trimmed+sep+"key")
+		}
+	}
+	return names
+}
+
+// siblingKeyPaths returns the conventional key paths of a certificate file.
+func siblingKeyPaths(path string) []string {
+	var paths []string
+	for _, name := range keyFileNames(filepath.Base(path)) {
+		paths = append(paths, filepath.Join(filepath.Dir(path), name))
+	}
+	return paths
+}
+
+// pairKeys sets Key on certs from keys, both coming from one source. A cert
+// is matched by any key with the same public key; the leaf of a file that
+// none matches is flagged mismatch when the file or its conventional key file
+// holds a key, missing otherwise. Keys neither matching a certificate nor
+// sitting with one (same file or conventional name) are returned as
+// orphan_key errors.
+func pairKeys(certs []*CertInfo, keys []*KeyInfo) []*CertError {
+	byPub := make(map[string]*KeyInfo)
+	byPath := make(map[string][]*KeyInfo)
+	for _, k := range keys {
+		if _, ok := byPub[k.PublicKeySHA256]; !ok {
+			byPub[k.PublicKeySHA256] = k
+		}
+		byPath[k.FilePath] = append(byPath[k.FilePath], k)
+	}
+
+	matched := make(map[string]bool) // public keys of matched certificates
+	claimed := make(map[string]bool) // key files sitting with certificates
+	for _, b := range bundles(certs) {
+		path := b.infos[0].FilePath
+		near := byPath[path]
+		claimed[path] = true
+		for _, p := range siblingKeyPaths(path) {
+			near = append(near, byPath[p]...)
+			claimed[p] = true
+		}
+
+		// Prefer the key next to the cert when the same key is stored twice
+		for _, ci := range b.infos {
+			var match *KeyInfo
+			for _, k := range near {
+				if k.PublicKeySHA256 == ci.PublicKeySHA256 {
+					match = k
+					break
+				}
+			}
+			if match == nil {
+				match = byPub[ci.PublicKeySHA256]
+			}
+			if match != nil {
+				matched[match.PublicKeySHA256] = true
+				ci.Key = &KeyStatus{Match: true, KeyPath: match.FilePath}
+			}
+		}
+
+		leaf := b.infos[leafIndex(b.certs)]
+		switch {
+		case leaf.Key != nil || leaf.IsCA:
+		case len(near) > 0:
+			leaf.Key = &KeyStatus{Reason: KeyMismatch, KeyPath: near[0].FilePath}
+		default:
+			leaf.Key = &KeyStatus{Reason: KeyMissing}
+		}
+	}
+
+	var errs []*CertError
+	for _, k := range keys {
+		if !matched[k.PublicKeySHA256] && !claimed[k.FilePath] {
+			errs = append(errs, NewCertError(k.FilePath, ErrTypeOrphanKey, errors.New("private key matches no certificate")))
+		}
+	}
+	return errs
+}
+
+// readSiblingKeys parses the conventional key files of a certificate file,
+// those that exist.
+func readSiblingKeys(path string) ([]*KeyInfo, []*CertError) {
+	var keys []*KeyInfo
+	var errs []*CertError
+	for _, p := range siblingKeyPaths(path) {
+		data, err := os.ReadFile(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, NewCertError(p, ErrTypeRead, err))
+			continue
+		}
+		ks, es := parsePrivateKeys(p, data)
+		keys = append(keys, ks...)
+		errs = append(errs, es...)
+	}
+	return keys, errs
+}
@@ -0,0 +1,192 @@
+package certloader
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func ecKeyPEM(t *testing.T, c *testIssuer) []byte {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func pkcs8KeyDER(t *testing.T, c *testIssuer) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return der
+}
+
+// keyStatuses returns "file cn: status" for every cert with a Key, sorted.
+func keyStatuses(certs []*CertInfo) []string {
+	var out []string
+	for _, c := range certs {
+		if c.Key == nil {
+			continue
+		}
+		status := "match " + filepath.Base(c.Key.KeyPath)
+		if !c.Key.Match {
+			status = string(c.Key.Reason) + " " + filepath.Base(c.Key.KeyPath)
+		}
+		out = append(out, fmt.Sprintf("%s %s: %s", filepath.Base(c.FilePath), c.CommonName, status))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestDirLoader_PairKeys(t *testing.T) {
+	now := time.Now()
+	issue := func(cn string, parent *testIssuer, isCA bool) *testIssuer {
+		return issueTestCert(t, cn, parent, isCA, now.Add(-time.Hour), now.Add(time.Hour))
+	}
+	ca := issue("CA", nil, true)
+	tls, web, renewed, old, lonely, moved, stray := issue("tls", ca, false), issue("web", ca, false),
+		issue("renewed", ca, false), issue("old", ca, false), issue("lonely", ca, false), issue("moved", ca, false), issue("stray", ca, false)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "tls.crt", pemBundle(tls, ca))
+	writeFile(t, dir, "tls.key", ecKeyPEM(t, tls))
+	writeFile(t, dir, "web.pem", append(pemBundle(web), ecKeyPEM(t, web)...))
+	writeFile(t, dir, "renewed-cert.pem", pemBundle(renewed))
+	writeFile(t, dir, "renewed-key.pem", ecKeyPEM(t, old)) // renewal kept the old key
+	writeFile(t, dir, "lonely.crt", pemBundle(lonely))
+	writeFile(t, dir, "ca.crt", pemBundle(ca))
+	writeFile(t, dir, "moved.crt", pemBundle(moved))
+	if err := os.Mkdir(filepath.Join(dir, "private"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "private"), "moved.key", ecKeyPEM(t, moved))
+	writeFile(t, dir, "stray.key", pkcs8KeyDER(t, stray))
+
+	cache, _ := NewScanCache("")
+	l := NewDirLoader(dir, slog.Default())
+	l.Include = []string{"*.crt", "*.pem"} // .key files are read anyway
+	l.PairKeys, l.Cache = true, cache
+
+	want := []string{
+		"lonely.crt lonely: missing .",
+		"moved.crt moved: match moved.key",
+		"renewed-cert.pem renewed: mismatch renewed-key.pem",
+		"tls.crt tls: match tls.key",
+		"web.pem web: match web.pem",
+	}
+	for i := 0; i < 2; i++ {
+		certs, errs := l.LoadCertificates(context.Background())
+		if fmt.Sprint(keyStatuses(certs)) != fmt.Sprint(want) {
+			t.Errorf("scan %d: expected\n%v\ngot\n%v", i, want, keyStatuses(certs))
+		}
+		if len(errs) != 1 || errs[0].Type != ErrTypeOrphanKey || filepath.Base(errs[0].Path) != "stray.key" {
+			t.Errorf("scan %d: expected stray.key to be an orphan, got %v", i, errs)
+		}
+	}
+	if s := cache.Stats(); s.Hits == 0 {
+		t.Errorf("expected the second scan to hit the cache, got %+v", s)
+	}
+
+	// Keys are not read unless asked for
+	l = NewDirLoader(dir, slog.Default())
+	certs, errs := l.LoadCertificates(context.Background())
+	if len(errs) != 0 || len(keyStatuses(certs)) != 0 {
+		t.Errorf("expected no pairing, got %v and %v", keyStatuses(certs), errs)
+	}
+}
+
+func TestDirLoader_PairKeysRescan(t *testing.T) {
+	now := time.Now()
+	old := issueTestCert(t, "web", nil, false, now.Add(-time.Hour), now.Add(time.Hour))
+	renewed := issueTestCert(t, "web", nil, false, now.Add(-time.Hour), now.Add(time.Hour))
+
+	dir := t.TempDir()
+	certPath := writeFile(t, dir, "web.crt", pemBundle(old))
+	keyPath := writeFile(t, dir, "web.key", ecKeyPEM(t, old))
+
+	l := NewDirLoader(dir, slog.Default())
+	l.PairKeys = true
+	if certs, _ := l.LoadCertificates(context.Background()); fmt.Sprint(keyStatuses(certs)) != "[web.crt web: match web.key]" {
+		t.Fatalf("unexpected initial pairing %v", keyStatuses(certs))
+	}
+
+	// The cert is renewed, the key is not: only the cert file is rescanned
+	writeFile(t, dir, "web.crt", pemBundle(renewed))
+	certs, _ := l.rescan(context.Background(), []string{certPath})
+	if got := fmt.Sprint(keyStatuses(certs)); got != "[web.crt web: mismatch web.key]" {
+		t.Errorf("expected a mismatch after the cert changed, got %s", got)
+	}
+
+	writeFile(t, dir, "web.key", ecKeyPEM(t, renewed))
+	certs, _ = l.rescan(context.Background(), []string{keyPath})
+	if got := fmt.Sprint(keyStatuses(certs)); got != "[web.crt web: match web.key]" {
+		t.Errorf("expected a match once the key is renewed too, got %s", got)
+	}
+}
+
+func TestFileLoader_PairKeys(t *testing.T) {
+	now := time.Now()
+	leaf := issueTestCert(t, "leaf", nil, false, now.Add(-time.Hour), now.Add(time.Hour))
+	other := issueTestCert(t, "other", nil, false, now.Add(-time.Hour), now.Add(time.Hour))
+
+	dir := t.TempDir()
+	l := NewFileLoader(writeFile(t, dir, "server.pem", pemBundle(leaf)), slog.Default())
+	l.PairKeys = true
+
+	steps := []struct {
+		name, file string
+		key        []byte
+		want       string
+	}{
+		{"no key", "", nil, "[server.pem leaf: missing .]"},
+		{"wrong sibling", "server-key.pem", ecKeyPEM(t, other), "[server.pem leaf: mismatch server-key.pem]"},
+		{"matching DER sibling", "server.key", pkcs8KeyDER(t, leaf), "[server.pem leaf: match server.key]"},
+	}
+	for _, s := range steps {
+		if s.file != "" {
+			writeFile(t, dir, s.file, s.key)
+		}
+		certs, errs := l.LoadCertificates(context.Background())
+		if len(errs) != 0 {
+			t.Fatalf("%s: unexpected errors %v", s.name, errs)
+		}
+		if got := fmt.Sprint(keyStatuses(certs)); got != s.want {
+			t.Errorf("%s: expected %s, got %s", s.name, s.want, got)
+		}
+	}
+}
+
+func TestKeyFileNames(t *testing.T) {
+	tests := map[string]string{
+		"tls.crt":         "tls.key",
+		"server.pem":      "server-key.pem",
+		"server-cert.pem": "server-key.pem",
+		"client_cert.crt": "client_key.pem",
+		"fullchain.pem":   "privkey.pem",
+		"app.crt.pem":     "app.key.pem",
+	}
+	for name, want := range tests {
+		found := false
+		for _, n := range keyFileNames(name) {
+			found = found || n == want
+		}
+		if !found {
+			t.Errorf("%s: expected %s among %v", name, want, keyFileNames(name))
+		}
+	}
+	for _, name := range []string{"bundle.p12", "keystore.jks", "README"} {
+		if names := keyFileNames(name); len(names) != 0 {
+			t.Errorf("%s: expected no key file names, got %v", name, names)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package certloader
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kubeconfig is the subset of a kubectl config file x509-watch understands.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string      `yaml:"name"`
+		Cluster kubeCluster `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string   `yaml:"name"`
+		User kubeUser `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string      `yaml:"name"`
+		Context kubeContext `yaml:"context"`
+	} `yaml:"contexts"`
+
+	dir string // relative file references are resolved against it
+}
+
+type kubeCluster struct {
+	Server                   string `yaml:"server"`
+	CertificateAuthority     string `yaml:"certificate-authority"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data"`
+	InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+	TLSServerName            string `yaml:"tls-server-name"`
+}
+
+type kubeUser struct {
+	Token                 string `yaml:"token"`
+	TokenFile             string `yaml:"tokenFile"`
+	ClientCertificate     string `yaml:"client-certificate"`
+	ClientCertificateData string `yaml:"client-certificate-data"`
+	ClientKey             string `yaml:"client-key"`
+	ClientKeyData         string `yaml:"client-key-data"`
+	Exec                  any    `yaml:"exec"`
+	AuthProvider          any    `yaml:"auth-provider"`
+}
+
+type kubeContext struct {
+	Cluster   string `yaml:"cluster"`
+	User      string `yaml:"user"`
+	Namespace string `yaml:"namespace"`
+}
+
+// DefaultKubeconfig returns the kubeconfig kubectl would use: the first
+// entry of $KUBECONFIG, or ~/.kube/config.
+func DefaultKubeconfig() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		return filepath.SplitList(env)[0]
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "config")
+}
+
+func loadKubeconfig(path string) (*kubeconfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseKubeconfig(path, data)
+}
+
+func parseKubeconfig(path string, data []byte) (*kubeconfig, error) {
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("parse kubeconfig: %w", err)
+	}
+	kc.dir = filepath.Dir(path)
+	return &kc, nil
+}
+
+// resolve returns the cluster and user of the named context, the current
+// context when name is empty.
+func (kc *kubeconfig) resolve(name string) (*kubeCluster, *kubeUser, error) {
+	if name == "" {
+		name = kc.CurrentContext
+	}
+	if name == "" {
+		return nil, nil, errors.New("kubeconfig has no current-context")
+	}
+
+	var ctx *kubeContext
+	for i := range kc.Contexts {
+		if kc.Contexts[i].Name == name {
+			ctx = &kc.Contexts[i].Context
+		}
+	}
+	if ctx == nil {
+		return nil, nil, fmt.Errorf("context %q not found in kubeconfig", name)
+	}
+
+	var cluster *kubeCluster
+	for i := range kc.Clusters {
+		if kc.Clusters[i].Name == ctx.Cluster {
+			cluster = &kc.Clusters[i].Cluster
+		}
+	}
+	if cluster == nil {
+		return nil, nil, fmt.Errorf("cluster %q of context %q not found in kubeconfig", ctx.Cluster, name)
+	}
+
+	user := &kubeUser{}
+	for i := range kc.Users {
+		if kc.Users[i].Name == ctx.User {
+			user = &kc.Users[i].User
+		}
+	}
+	return cluster, user, nil
+}
+
+// readData returns inline base64 data, or the content of file (relative to
+// the kubeconfig), or nil when both are empty.
+func (kc *kubeconfig) readData(file, data string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	}
+	if file == "" {
+		return nil, nil
+	}
+	return os.ReadFile(kc.path(file))
+}
+
+func (kc *kubeconfig) path(file string) string {
+	if file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(kc.dir, file)
+}
+
+// Metric labels of certificates found in a kubeconfig.
+const (
+	ClusterLabel = "cluster"
+	UserLabel    = "user"
+	ContextLabel = "context"
+)
+
+// KubeconfigLoader reports the cluster CAs and client certificates of a
+// kubeconfig, inline (*-data) or referenced by path. Certificates are listed
+// once per context using them, labelled with its cluster, user and context
+// names; clusters and users no context refers to get an empty context label.
+// The user label is empty on cluster CAs.
+type KubeconfigLoader struct {
+	Path   string
+	Logger *slog.Logger
+}
+
+func NewKubeconfigLoader(path string, logger *slog.Logger) *KubeconfigLoader {
+	return &KubeconfigLoader{
+		Path:   path,
+		Logger: logger,
+	}
+}
+
+func (l *KubeconfigLoader) LoadCertificates(ctx context.Context) ([]*CertInfo, []*CertError) {
+	if ctx.Err() != nil {
+		return nil, []*CertError{NewCertError(l.Path, ErrTypeUnknown, ctx.Err())}
+	}
+
+	l.Logger.Debug("Loading certificates from kubeconfig", "path", l.Path)
+	data, err := os.ReadFile(l.Path)
+	if err != nil {
+		return nil, []*CertError{NewCertError(l.Path, ErrTypeRead, err)}
+	}
+	kc, err := parseKubeconfig(l.Path, data)
+	if err != nil {
+		return nil, []*CertError{NewCertError(l.Path, ErrTypeParse, err)}
+	}
+
+	// Decode every cluster and user once, whatever the number of contexts
+	var errs []*CertError
+	clusters := make(map[string][]*CertInfo, len(kc.Clusters))
+	for _, c := range kc.Clusters {
+		certs, es := l.decode(kc, c.Cluster.CertificateAuthority, c.Cluster.CertificateAuthorityData)
+		clusters[c.Name] = certs
+		errs = append(errs, es...)
+	}
+	users := make(map[string][]*CertInfo, len(kc.Users))
+	for _, u := range kc.Users {
+		certs, es := l.decode(kc, u.User.ClientCertificate, u.User.ClientCertificateData)
+		users[u.Name] = certs
+		errs = append(errs, es...)
+	}
+
+	var certs []*CertInfo
+	add := func(found []*CertInfo, cluster, user, contextName string) {
+		for _, c := range found {
+			c = c.clone()
+			if c.Labels == nil {
+				c.Labels = make(map[string]string, 3)
+			}
+			c.Labels[ClusterLabel], c.Labels[UserLabel], c.Labels[ContextLabel] = cluster, user, contextName
+			certs = append(certs, c)
+		}
+	}
+
+	usedClusters, usedUsers := make(map[string]bool), make(map[string]bool)
+	for _, c := range kc.Contexts {
+		add(clusters[c.Context.Cluster], c.Context.Cluster, "", c.Name)
+		add(users[c.Context.User], c.Context.Cluster, c.Context.User, c.Name)
+		usedClusters[c.Context.Cluster], usedUsers[c.Context.User] = true, true
+	}
+	for _, c := range kc.Clusters {
+		if !usedClusters[c.Name] {
+			add(clusters[c.Name], c.Name, "", "")
+		}
+	}
+	for _, u := range kc.Users {
+		if !usedUsers[u.Name] {
+			add(users[u.Name], "", u.Name, "")
+		}
+	}
+	return certs, errs
+}
+
+// decode parses inline base64 data, reported under the kubeconfig path, or
+// the referenced file, reported under its own path.
+func (l *KubeconfigLoader) decode(kc *kubeconfig, file, data string) ([]*CertInfo, []*CertError) {
+	switch {
+	case data != "":
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+		if err != nil {
+			return nil, []*CertError{NewCertError(l.Path, ErrTypeParse, fmt.Errorf("invalid base64: %w", err))}
+		}
+		return parseCertificates(l.Path, decoded, nil, l.Logger)
+	case file != "":
+		path := kc.path(file)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, []*CertError{NewCertError(path, ErrTypeRead, err)}
+		}
+		return parseCertificates(path, content, nil, l.Logger)
+	}
+	return nil, nil
+}
@@ -0,0 +1,100 @@
+package certloader
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestKubeconfigLoader(t *testing.T) {
+	now := time.Now()
+	dir := t.TempDir()
+	b64 := func(data []byte) string { return base64.StdEncoding.EncodeToString(data) }
+
+	prodCA := generateTestCert(t, "prod-ca", now, now.Add(time.Hour))
+	admin := generateTestCert(t, "admin", now, now.Add(time.Hour))
+	writeFile(t, dir, "dev-ca.crt", generateTestCert(t, "dev-ca", now, now.Add(time.Hour)))
+	writeFile(t, dir, "dev.crt", generateTestCert(t, "dev-user", now, now.Add(time.Hour)))
+
+	path := writeFile(t, dir, "config", []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+- name: prod
+  cluster: {server: "https://prod:6443", certificate-authority-data: %s}
+- name: dev
+  cluster: {server: "https://dev:6443", certificate-authority: dev-ca.crt}
+- name: old
+  cluster: {server: "https://old:6443", certificate-authority: /nonexistent/ca.crt}
+users:
+- name: admin
+  user: {client-certificate-data: %s, client-key-data: a2V5}
+- name: dev
+  user: {client-certificate: dev.crt, client-key: dev.key}
+- name: sso
+  user: {token: abc}
+- name: broken
+  user: {client-certificate-data: "!!"}
+contexts:
+- name: prod
+  context: {cluster: prod, user: admin}
+- name: prod-sso
+  context: {cluster: prod, user: sso}
+- name: dev
+  context: {cluster: dev, user: dev, namespace: team}
+`, b64(prodCA), b64(admin))))
+
+	certs, errs := NewKubeconfigLoader(path, slog.Default()).LoadCertificates(context.Background())
+
+	var gotErrs []string
+	for _, e := range errs {
+		gotErrs = append(gotErrs, fmt.Sprintf("%s %s", e.Type, filepath.Base(e.Path)))
+	}
+	sort.Strings(gotErrs)
+	if want := "[parse_error config read_error ca.crt]"; fmt.Sprint(gotErrs) != want {
+		t.Errorf("expected errors %s, got %v", want, gotErrs)
+	}
+
+	var got []string
+	for _, c := range certs {
+		got = append(got, fmt.Sprintf("%s %s cluster=%s user=%s context=%s", c.CommonName, filepath.Base(c.FilePath),
+			c.Labels[ClusterLabel], c.Labels[UserLabel], c.Labels[ContextLabel]))
+	}
+	want := []string{
+		"prod-ca config cluster=prod user= context=prod",
+		"admin config cluster=prod user=admin context=prod",
+		"prod-ca config cluster=prod user= context=prod-sso",
+		"dev-ca dev-ca.crt cluster=dev user= context=dev",
+		"dev-user dev.crt cluster=dev user=dev context=dev",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected\n%v\ngot\n%v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("cert %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestKubeconfigLoader_Errors(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]struct {
+		path string
+		want CertErrorType
+	}{
+		"missing":  {filepath.Join(dir, "missing"), ErrTypeRead},
+		"not yaml": {writeFile(t, dir, "config", []byte("clusters: [")), ErrTypeParse},
+	}
+	for name, tc := range tests {
+		certs, errs := NewKubeconfigLoader(tc.path, slog.Default()).LoadCertificates(context.Background())
+		if len(certs) != 0 || len(errs) != 1 || errs[0].Type != tc.want {
+			t.Errorf("%s: expected a single %s, got %d certs and %v", name, tc.want, len(certs), errs)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package certloader
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric labels of certificates read from the Kubernetes API.
+const (
+	NamespaceLabel = "namespace"
+	SecretLabel    = "secret"
+	ConfigMapLabel = "configmap"
+	KeyLabel       = "key"
+)
+
+const (
+	defaultKubernetesTimeout = 10 * time.Second
+	kubernetesPageSize       = 500
+	maxKubernetesResponse    = 64 << 20
+)
+
+// DefaultKubernetesKeys are the data keys decoded in every secret or ConfigMap.
+var DefaultKubernetesKeys = []string{"tls.crt", "ca.crt"}
+
+// serviceAccountDir holds the credentials mounted in every pod.
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// KubeClient is a minimal Kubernetes API client: bearer token or client
+// certificate auth, GET only.
+type KubeClient struct {
+	Server    string
+	Token     string
+	TokenFile string // re-read on every request, projected tokens rotate
+	HTTP      *http.Client
+
+	files []string // the client was built from, see KubernetesLoader.client
+}
+
+// kubeAuthError is an answer of the API server rejecting the credentials.
+type kubeAuthError struct{ error }
+
+// NewKubeClient authenticates in-cluster when kubeconfig is empty and the
+// pod environment is present, from the kubeconfig otherwise (DefaultKubeconfig
+// when empty). kubeContext selects a kubeconfig context, the current one by
+// default.
+func NewKubeClient(kubeconfig, kubeContext string, timeout time.Duration) (*KubeClient, error) {
+	if kubeconfig == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return NewInClusterKubeClient(timeout)
+	}
+	if kubeconfig == "" {
+		kubeconfig = DefaultKubeconfig()
+	}
+	return NewKubeconfigClient(kubeconfig, kubeContext, timeout)
+}
+
+// NewInClusterKubeClient uses the service account mounted in the pod.
+func NewInClusterKubeClient(timeout time.Duration) (*KubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set")
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("read service account CA: %w", err)
+	}
+	tlsConfig, err := kubeTLSConfig(ca, false, "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &KubeClient{
+		Server:    "https://" + net.JoinHostPort(host, port),
+		TokenFile: filepath.Join(serviceAccountDir, "token"),
+		HTTP:      kubeHTTPClient(tlsConfig, timeout),
+		files:     []string{filepath.Join(serviceAccountDir, "ca.crt")},
+	}, nil
+}
+
+// NewKubeconfigClient uses the cluster and user of a kubeconfig context.
+// exec and auth-provider credential plugins are not supported.
+func NewKubeconfigClient(path, kubeContext string, timeout time.Duration) (*KubeClient, error) {
+	kc, err := loadKubeconfig(path)
+	if err != nil {
+		return nil, err
+	}
+	cluster, user, err := kc.resolve(kubeContext)
+	if err != nil {
+		return nil, err
+	}
+	if user.Exec != nil || user.AuthProvider != nil {
+		return nil, errors.New("exec and auth-provider credentials are not supported, use a token or a client certificate")
+	}
+
+	ca, err := kc.readData(cluster.CertificateAuthority, cluster.CertificateAuthorityData)
+	if err != nil {
+		return nil, fmt.Errorf("cluster CA: %w", err)
+	}
+	cert, err := kc.readData(user.ClientCertificate, user.ClientCertificateData)
+	if err != nil {
+		return nil, fmt.Errorf("client certificate: %w", err)
+	}
+	key, err := kc.readData(user.ClientKey, user.ClientKeyData)
+	if err != nil {
+		return nil, fmt.Errorf("client key: %w", err)
+	}
+	tlsConfig, err := kubeTLSConfig(ca, cluster.InsecureSkipTLSVerify, cluster.TLSServerName, cert, key)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	for _, file := range []string{cluster.CertificateAuthority, user.ClientCertificate, user.ClientKey} {
+		if file != "" {
+			files = append(files, kc.path(file))
+		}
+	}
+	return &KubeClient{
+		Server:    strings.TrimSuffix(cluster.Server, "/"),
+		Token:     user.Token,
+		TokenFile: kc.path(user.TokenFile),
+		HTTP:      kubeHTTPClient(tlsConfig, timeout),
+		files:     files,
+	}, nil
+}
+
+func kubeTLSConfig(ca []byte, insecure bool, serverName string, cert, key []byte) (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: insecure,
+		ServerName:         serverName,
+	}
+	if len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("no certificate found in the cluster CA")
+		}
+		cfg.RootCAs = pool
+	}
+	if len(cert) > 0 || len(key) > 0 {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return cfg, nil
+}
+
+func kubeHTTPClient(tlsConfig *tls.Config, timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = defaultKubernetesTimeout
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// get decodes the JSON answer of a GET on the API path into out.
+func (c *KubeClient) get(ctx context.Context, path string, query url.Values, out any) error {
+	u := c.Server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	token := c.Token
+	if c.TokenFile != "" {
+		data, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return fmt.Errorf("read token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxKubernetesResponse))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var status struct {
+			Message string `json:"message"`
+		}
+		err := fmt.Errorf("unexpected status %s", resp.Status)
+		if json.Unmarshal(body, &status) == nil && status.Message != "" {
+			err = fmt.Errorf("unexpected status %s: %s", resp.Status, status.Message)
+		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			return kubeAuthError{err}
+		}
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+// KubernetesLoader decodes the certificates held by secrets (and optionally
+// ConfigMaps) listed through the Kubernetes API. Each certificate is labelled
+// with its namespace, secret or configmap name and data key.
+type KubernetesLoader struct {
+	Namespace     string   // "" = all namespaces
+	LabelSelector string   // e.g. "app=web,tier!=cache"
+	ConfigMaps    bool     // list ConfigMaps as well as secrets
+	Keys          []string // data keys to decode
+	Logger        *slog.Logger
+
+	// Client is built on first use from Kubeconfig and Context (see
+	// NewKubeClient), so that a missing kubeconfig is reported on every scan.
+	// It is built again when the files it was read from change or the API
+	// server rejects its credentials.
+	Client     *KubeClient
+	Kubeconfig string
+	Context    string
+	Timeout    time.Duration
+
+	mu    sync.Mutex
+	built bool   // Client was built here, not set by the caller
+	stamp string // of the files Client was built from, see filesStamp
+}
+
+func NewKubernetesLoader(namespace, selector string, logger *slog.Logger) *KubernetesLoader {
+	return &KubernetesLoader{
+		Namespace:     namespace,
+		LabelSelector: selector,
+		Keys:          DefaultKubernetesKeys,
+		Logger:        logger,
+	}
+}
+
+// kubeObject is a secret or a ConfigMap. Secret data and ConfigMap binaryData
+// are base64 in JSON, which []byte decodes.
+type kubeObject struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Data       map[string]json.RawMessage `json:"data"`
+	BinaryData map[string][]byte          `json:"binaryData"`
+}
+
+type kubeList struct {
+	Metadata struct {
+		Continue string `json:"continue"`
+	} `json:"metadata"`
+	Items []kubeObject `json:"items"`
+}
+
+func (l *KubernetesLoader) LoadCertificates(ctx context.Context) ([]*CertInfo, []*CertError) {
+	client, err := l.client()
+	if err != nil {
+		return nil, []*CertError{NewCertError("kubernetes", ErrTypeRead, err)}
+	}
+
+	var certs []*CertInfo
+	var errs []*CertError
+	kinds := []string{"secrets"}
+	if l.ConfigMaps {
+		kinds = append(kinds, "configmaps")
+	}
+	for _, kind := range kinds {
+		cs, es := l.load(ctx, client, kind)
+		certs = append(certs, cs...)
+		errs = append(errs, es...)
+	}
+	return certs, errs
+}
+
+func (l *KubernetesLoader) client() (*KubeClient, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.Client != nil && (!l.built || filesStamp(l.Client.files) == l.stamp) {
+		return l.Client, nil
+	}
+	if l.Client != nil {
+		l.Logger.Info("Kubernetes credentials changed, reloading them", "files", l.Client.files)
+	}
+	client, err := NewKubeClient(l.Kubeconfig, l.Context, l.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if l.Client != nil {
+		l.Client.HTTP.CloseIdleConnections()
+	}
+	l.Client, l.built, l.stamp = client, true, filesStamp(client.files)
+	return client, nil
+}
+
+// forget drops client after the API server rejected its credentials, so that
+// the next scan builds it again, e.g. from a renewed client certificate.
+func (l *KubernetesLoader) forget(client *KubeClient) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.built && l.Client == client {
+		l.Client.HTTP.CloseIdleConnections()
+		l.Client = nil
+	}
+}
+
+// filesStamp identifies the content of files by their size and modification
+// time, following symlinks: mounted secrets are replaced by a symlink swap.
+func filesStamp(files []string) string {
+	var b strings.Builder
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			fmt.Fprintf(&b, "%s %d %d\n", f, fi.Size(), fi.ModTime().UnixNano())
+		} else {
+			fmt.Fprintf(&b, "%s -\n", f)
+		}
+	}
+	return b.String()
+}
+
+// load lists every object of kind (secrets or configmaps), page by page.
+func (l *KubernetesLoader) load(ctx context.Context, client *KubeClient, kind string) ([]*CertInfo, []*CertError) {
+	path := "/api/v1/" + kind
+	if l.Namespace != "" {
+		path = "/api/v1/namespaces/" + url.PathEscape(l.Namespace) + "/" + kind
+	}
+	query := url.Values{"limit": {fmt.Sprint(kubernetesPageSize)}}
+	if l.LabelSelector != "" {
+		query.Set("labelSelector", l.LabelSelector)
+	}
+
+	var certs []*CertInfo
+	var errs []*CertError
+	for {
+		l.Logger.Debug("Listing Kubernetes objects", "path", path, "selector", l.LabelSelector)
+		var list kubeList
+		if err := client.get(ctx, path, query, &list); err != nil {
+			if errors.As(err, new(kubeAuthError)) {
+				l.forget(client)
+			}
+			return certs, append(errs, NewCertError(path, ErrTypeRead, err))
+		}
+		for _, obj := range list.Items {
+			cs, es := l.decode(kind, obj)
+			certs = append(certs, cs...)
+			errs = append(errs, es...)
+		}
+		if list.Metadata.Continue == "" {
+			return certs, errs
+		}
+		query.Set("continue", list.Metadata.Continue)
+	}
+}
+
+// decode parses the configured keys of one object. Missing keys are not
+// errors: an Opaque secret usually has no tls.crt.
+func (l *KubernetesLoader) decode(kind string, obj kubeObject) ([]*CertInfo, []*CertError) {
+	nameLabel := SecretLabel
+	if kind == "configmaps" {
+		nameLabel = ConfigMapLabel
+	}
+
+	var certs []*CertInfo
+	var errs []*CertError
+	for _, key := range l.Keys {
+		data, ok, err := obj.value(kind, key)
+		if !ok {
+			continue
+		}
+		path := fmt.Sprintf("%s/%s/%s/%s", kind, obj.Metadata.Namespace, obj.Metadata.Name, key)
+		if err != nil {
+			errs = append(errs, NewCertError(path, ErrTypeParse, err))
+			continue
+		}
+
+		cs, es := parseCertificates(path, data, nil, l.Logger)
+		for _, c := range cs {
+			if c.Labels == nil {
+				c.Labels = make(map[string]string, 3)
+			}
+			c.Labels[NamespaceLabel] = obj.Metadata.Namespace
+			c.Labels[nameLabel] = obj.Metadata.Name
+			c.Labels[KeyLabel] = key
+		}
+		certs = append(certs, cs...)
+		errs = append(errs, es...)
+	}
+	return certs, errs
+}
+
+// value returns the raw content of a data key: base64 in secrets, plain text
+// in ConfigMap data, base64 in ConfigMap binaryData.
+func (o kubeObject) value(kind, key string) ([]byte, bool, error) {
+	if b, ok := o.BinaryData[key]; ok {
+		return b, true, nil
+	}
+	raw, ok := o.Data[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if kind == "secrets" {
+		var b []byte
+		err := json.Unmarshal(raw, &b)
+		return b, true, err
+	}
+	var s string
+	err := json.Unmarshal(raw, &s)
+	return []byte(s), true, err
+}
@@ -0,0 +1,240 @@
+package certloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+// fakeKubeAPI serves secrets and ConfigMaps the way the API server lists
+// them, two objects per page, and only to callers presenting token.
+func fakeKubeAPI(t *testing.T, token string, secrets, configMaps []map[string]any) *httptest.Server {
+	t.Helper()
+	objects := map[string][]map[string]any{"secrets": secrets, "configmaps": configMaps}
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]any{"kind": "Status", "message": "Unauthorized"})
+			return
+		}
+
+		var ns, kind string
+		if _, err := fmt.Sscanf(r.URL.Path, "/api/v1/namespaces/%s", &ns); err == nil {
+			ns, kind = filepath.Dir(ns), filepath.Base(ns)
+		} else {
+			kind = filepath.Base(r.URL.Path)
+		}
+		if r.URL.Query().Get("labelSelector") != "app=web" {
+			t.Errorf("unexpected selector %q", r.URL.Query().Get("labelSelector"))
+		}
+
+		var items []map[string]any
+		for _, obj := range objects[kind] {
+			if ns == "" || obj["metadata"].(map[string]any)["namespace"] == ns {
+				items = append(items, obj)
+			}
+		}
+		start := 0
+		fmt.Sscan(r.URL.Query().Get("continue"), &start)
+		end, next := min(start+2, len(items)), ""
+		if end < len(items) {
+			next = fmt.Sprint(end)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"metadata": map[string]any{"continue": next},
+			"items":    items[start:end],
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func kubeObj(namespace, name string, data map[string]any) map[string]any {
+	return map[string]any{
+		"metadata": map[string]any{"namespace": namespace, "name": name},
+		"data":     data,
+	}
+}
+
+// writeTestKubeconfig points a kubeconfig at srv, its CA stored next to it.
+func writeTestKubeconfig(t *testing.T, srv *httptest.Server, token string) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, dir, "ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	return writeFile(t, dir, "config", []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+- name: test
+  cluster:
+    server: %s
+    certificate-authority: ca.pem
+users:
+- name: test
+  user:
+    token: %s
+contexts:
+- name: test
+  context: {cluster: test, user: test}
+`, srv.URL, token)))
+}
+
+func TestKubernetesLoader(t *testing.T) {
+	now := time.Now()
+	web := generateTestCert(t, "web.example.com", now, now.Add(time.Hour))
+	ca := generateTestCert(t, "Web CA", now, now.Add(time.Hour))
+	api := generateTestCert(t, "api.example.com", now, now.Add(time.Hour))
+	bundle := generateTestCert(t, "Bundle CA", now, now.Add(time.Hour))
+
+	srv := fakeKubeAPI(t, "s3cret",
+		[]map[string]any{
+			kubeObj("default", "web-tls", map[string]any{"tls.crt": web, "ca.crt": ca, "tls.key": []byte("key")}),
+			kubeObj("default", "opaque", map[string]any{"password": []byte("x")}),
+			kubeObj("prod", "api-tls", map[string]any{"tls.crt": api, "truststore.pem": bundle}),
+			kubeObj("prod", "broken", map[string]any{"tls.crt": []byte("garbage")}),
+		},
+		[]map[string]any{
+			kubeObj("prod", "bundle", map[string]any{"ca.crt": string(bundle)}),
+		},
+	)
+
+	l := NewKubernetesLoader("", "app=web", slog.Default())
+	l.Kubeconfig = writeTestKubeconfig(t, srv, "s3cret")
+	l.Keys = slices.Concat(DefaultKubernetesKeys, []string{"truststore.pem"})
+	l.ConfigMaps = true
+
+	certs, errs := l.LoadCertificates(context.Background())
+	if len(errs) != 1 || errs[0].Type != ErrTypePEM || errs[0].Path != "secrets/prod/broken/tls.crt" {
+		t.Errorf("expected a pem_error on the broken secret, got %v", errs)
+	}
+
+	var got []string
+	for _, c := range certs {
+		got = append(got, fmt.Sprintf("%s %s/%s%s/%s", c.CommonName, c.Labels[NamespaceLabel],
+			c.Labels[SecretLabel], c.Labels[ConfigMapLabel], c.Labels[KeyLabel]))
+	}
+	sort.Strings(got)
+	want := []string{
+		"Bundle CA prod/api-tls/truststore.pem",
+		"Bundle CA prod/bundle/ca.crt",
+		"Web CA default/web-tls/ca.crt",
+		"api.example.com prod/api-tls/tls.crt",
+		"web.example.com default/web-tls/tls.crt",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected\n%v\ngot\n%v", want, got)
+	}
+
+	// Namespaced listing
+	l.Namespace, l.ConfigMaps = "default", false
+	certs, errs = l.LoadCertificates(context.Background())
+	if len(errs) != 0 || len(certs) != 2 {
+		t.Errorf("expected the 2 certs of namespace default, got %v and %v", commonNames(certs), errs)
+	}
+}
+
+func TestKubernetesLoader_InCluster(t *testing.T) {
+	now := time.Now()
+	srv := fakeKubeAPI(t, "pod-token", []map[string]any{
+		kubeObj("default", "web-tls", map[string]any{"tls.crt": generateTestCert(t, "web", now, now.Add(time.Hour))}),
+	}, nil)
+
+	saDir := t.TempDir()
+	writeFile(t, saDir, "ca.crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	writeFile(t, saDir, "token", []byte("pod-token\n"))
+	orig := serviceAccountDir
+	serviceAccountDir = saDir
+	t.Cleanup(func() { serviceAccountDir = orig })
+
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	t.Setenv("KUBERNETES_SERVICE_HOST", host)
+	t.Setenv("KUBERNETES_SERVICE_PORT", port)
+
+	l := NewKubernetesLoader("default", "app=web", slog.Default())
+	certs, errs := l.LoadCertificates(context.Background())
+	if len(errs) != 0 || len(certs) != 1 || certs[0].CommonName != "web" {
+		t.Fatalf("expected the web cert, got %v and %v", commonNames(certs), errs)
+	}
+
+	// The token is re-read: a rotated one is used on the next scan
+	writeFile(t, saDir, "token", []byte("expired"))
+	if _, errs := l.LoadCertificates(context.Background()); len(errs) != 1 || errs[0].Type != ErrTypeRead {
+		t.Fatalf("expected a read_error with a rejected token, got %v", errs)
+	}
+}
+
+func TestKubernetesLoader_CredentialRotation(t *testing.T) {
+	now := time.Now()
+	srv := fakeKubeAPI(t, "s3cret", []map[string]any{
+		kubeObj("default", "web-tls", map[string]any{"tls.crt": generateTestCert(t, "web", now, now.Add(time.Hour))}),
+	}, nil)
+	rotate := func(path, from, to string) {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, bytes.Replace(data, []byte("token: "+from), []byte("token: "+to), 1), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A rejected client is dropped, the next scan reads the kubeconfig again
+	l := NewKubernetesLoader("", "app=web", slog.Default())
+	l.Kubeconfig = writeTestKubeconfig(t, srv, "old")
+	if _, errs := l.LoadCertificates(context.Background()); len(errs) != 1 || errs[0].Type != ErrTypeRead {
+		t.Fatalf("expected a read_error with a rejected token, got %v", errs)
+	}
+	if l.Client != nil {
+		t.Error("expected the rejected client to be dropped")
+	}
+	rotate(l.Kubeconfig, "old", "s3cret")
+	if certs, errs := l.LoadCertificates(context.Background()); len(errs) != 0 || len(certs) != 1 {
+		t.Fatalf("expected the web cert with the new token, got %v and %v", commonNames(certs), errs)
+	}
+
+	// Unchanged files: the client is kept
+	client := l.Client
+	if _, errs := l.LoadCertificates(context.Background()); len(errs) != 0 || l.Client != client {
+		t.Fatalf("expected the client to be reused, got errors %v", errs)
+	}
+
+	// A changed kubeconfig is read again, even while the old client works
+	rotate(l.Kubeconfig, "s3cret", "revoked")
+	if _, errs := l.LoadCertificates(context.Background()); len(errs) != 1 || errs[0].Type != ErrTypeRead {
+		t.Fatalf("expected the new token to be used, got %v", errs)
+	}
+}
+
+func TestKubernetesLoader_Errors(t *testing.T) {
+	srv := fakeKubeAPI(t, "s3cret", nil, nil)
+
+	l := NewKubernetesLoader("", "app=web", slog.Default())
+	l.Kubeconfig = writeTestKubeconfig(t, srv, "wrong")
+	_, errs := l.LoadCertificates(context.Background())
+	if len(errs) != 1 || errs[0].Type != ErrTypeRead || errs[0].Path != "/api/v1/secrets" {
+		t.Fatalf("expected a read_error on the secrets list, got %v", errs)
+	}
+	if got := errs[0].Err.Error(); got != "unexpected status 401 Unauthorized: Unauthorized" {
+		t.Errorf("expected the API status message, got %q", got)
+	}
+
+	l = NewKubernetesLoader("", "", slog.Default())
+	l.Kubeconfig = filepath.Join(t.TempDir(), "missing")
+	if _, errs := l.LoadCertificates(context.Background()); len(errs) != 1 || !os.IsNotExist(errs[0].Err) {
+		t.Fatalf("expected a missing kubeconfig error, got %v", errs)
+	}
+}
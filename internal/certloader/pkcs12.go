@@ -0,0 +1,110 @@
+package certloader
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Passwords lists where keystore passwords come from. Candidates are tried in
+// order: File, Env, then List. Sources are read on every load, so rotated
+// secrets are picked up without a restart.
+type Passwords struct {
+	File string   // file holding the password (trailing newline ignored)
+	Env  string   // environment variable holding the password
+	List []string // literal passwords
+}
+
+// candidates returns the passwords to try, the empty password when none is configured.
+func (p *Passwords) candidates() ([]string, error) {
+	if p == nil {
+		return []string{""}, nil
+	}
+
+	var out []string
+	if p.File != "" {
+		data, err := os.ReadFile(p.File)
+		if err != nil {
+			return nil, fmt.Errorf("read password file: %w", err)
+		}
+		out = append(out, strings.TrimRight(string(data), "\r\n"))
+	}
+	if p.Env != "" {
+		if v, ok := os.LookupEnv(p.Env); ok {
+			out = append(out, v)
+		}
+	}
+	out = append(out, p.List...)
+
+	if len(out) == 0 {
+		return []string{""}, nil
+	}
+	return out, nil
+}
+
+// pfxHeader is the start of a PKCS#12 PFX PDU (RFC 7292), enough to tell a
+// keystore from another DER structure.
+type pfxHeader struct {
+	Version  int
+	AuthSafe struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+	}
+	MacData asn1.RawValue `asn1:"optional"`
+}
+
+func isPKCS12(data []byte) bool {
+	var pfx pfxHeader
+	rest, err := asn1.Unmarshal(data, &pfx)
+	return err == nil && len(rest) == 0 && pfx.Version == 3
+}
+
+// decodePKCS12 returns every certificate of a PKCS#12 keystore, leaf first.
+// Wrong passwords are reported as ErrTypePassword.
+func decodePKCS12(path string, data []byte, passwords *Passwords) ([]*x509.Certificate, *CertError) {
+	candidates, err := passwords.candidates()
+	if err != nil {
+		return nil, NewCertError(path, ErrTypePassword, err)
+	}
+
+	var lastErr error
+	for _, password := range candidates {
+		certs, err := decodePKCS12With(data, password)
+		if err == nil {
+			return certs, nil
+		}
+		if !isPasswordError(err) {
+			return nil, NewCertError(path, ErrTypeParse, err)
+		}
+		lastErr = err
+	}
+	return nil, NewCertError(path, ErrTypePassword,
+		fmt.Errorf("none of %d password(s) opens the keystore: %w", len(candidates), lastErr))
+}
+
+func isPasswordError(err error) bool {
+	return errors.Is(err, pkcs12.ErrIncorrectPassword) || errors.Is(err, pkcs12.ErrDecryption)
+}
+
+// decodePKCS12With handles both keystores (one key and its chain) and Java
+// trust stores (certificates only).
+func decodePKCS12With(data []byte, password string) ([]*x509.Certificate, error) {
+	_, leaf, chain, err := pkcs12.DecodeChain(data, password)
+	if err == nil {
+		return append([]*x509.Certificate{leaf}, chain...), nil
+	}
+	if isPasswordError(err) {
+		return nil, err
+	}
+
+	certs, tsErr := pkcs12.DecodeTrustStore(data, password)
+	if tsErr == nil {
+		return certs, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,140 @@
+package certloader
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// generateTestPKCS12 returns a keystore holding a leaf, its key and its CA.
+func generateTestPKCS12(t *testing.T, password string) []byte {
+	t.Helper()
+	now := time.Now()
+	ca := issueTestCert(t, "P12 CA", nil, true, now.Add(-time.Hour), now.Add(time.Hour))
+	leaf := issueTestCert(t, "p12.example.com", ca, false, now.Add(-time.Hour), now.Add(time.Hour))
+
+	data, err := pkcs12.Modern.Encode(leaf.key, leaf.cert, []*x509.Certificate{ca.cert}, password)
+	if err != nil {
+		t.Fatalf("encode PKCS#12: %v", err)
+	}
+	return data
+}
+
+func TestFileLoader_PKCS12(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "keystore.p12", generateTestPKCS12(t, "s3cret"))
+	pwFile := writeFile(t, dir, "password", []byte("s3cret\n"))
+	t.Setenv("TEST_P12_PASSWORD", "s3cret")
+
+	tests := []struct {
+		name      string
+		passwords *Passwords
+	}{
+		{"file", &Passwords{File: pwFile}},
+		{"env", &Passwords{Env: "TEST_P12_PASSWORD"}},
+		{"list, second candidate", &Passwords{List: []string{"changeit", "s3cret"}}},
+		{"wrong file then list", &Passwords{Env: "TEST_P12_UNSET", List: []string{"s3cret"}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewFileLoader(path, slog.Default())
+			l.Passwords = tc.passwords
+
+			certs, errs := l.LoadCertificates(context.Background())
+			if len(errs) != 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			if len(certs) != 2 || certs[0].CommonName != "p12.example.com" || certs[1].CommonName != "P12 CA" {
+				t.Fatalf("expected leaf then CA, got %v", commonNames(certs))
+			}
+			if certs[0].FilePath != path {
+				t.Errorf("expected filepath %s, got %s", path, certs[0].FilePath)
+			}
+		})
+	}
+}
+
+func TestFileLoader_PKCS12PasswordErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "keystore.pfx", generateTestPKCS12(t, "s3cret"))
+
+	for name, passwords := range map[string]*Passwords{
+		"none":          nil,
+		"wrong":         {List: []string{"changeit", "password"}},
+		"missing file":  {File: dir + "/missing"},
+		"unset env var": {Env: "TEST_P12_UNSET"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			l := NewFileLoader(path, slog.Default())
+			l.Passwords = passwords
+
+			certs, errs := l.LoadCertificates(context.Background())
+			if len(certs) != 0 || len(errs) != 1 || errs[0].Type != ErrTypePassword {
+				t.Fatalf("expected a single password_error, got %d certs and %v", len(certs), errs)
+			}
+		})
+	}
+}
+
+func TestFileLoader_PKCS12EmptyPasswordAndTrustStore(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	a := issueTestCert(t, "Trusted A", nil, true, now.Add(-time.Hour), now.Add(time.Hour))
+	b := issueTestCert(t, "Trusted B", nil, true, now.Add(-time.Hour), now.Add(time.Hour))
+
+	trustStore, err := pkcs12.Modern.EncodeTrustStore([]*x509.Certificate{a.cert, b.cert}, "")
+	if err != nil {
+		t.Fatalf("encode trust store: %v", err)
+	}
+	for name, data := range map[string][]byte{
+		"keystore.p12":   generateTestPKCS12(t, ""),
+		"truststore.p12": trustStore,
+	} {
+		certs, errs := NewFileLoader(writeFile(t, dir, name, data), slog.Default()).LoadCertificates(context.Background())
+		if len(errs) != 0 || len(certs) != 2 {
+			t.Errorf("%s: expected 2 certs without error, got %d and %v", name, len(certs), errs)
+		}
+	}
+}
+
+func TestDirLoader_PKCS12PasswordErrorNotCached(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "keystore.p12", generateTestPKCS12(t, "s3cret"))
+	pwFile := writeFile(t, t.TempDir(), "password", []byte("wrong"))
+
+	cache, _ := NewScanCache("")
+	l := NewDirLoader(dir, slog.Default())
+	l.Cache = cache
+	l.Passwords = &Passwords{File: pwFile}
+
+	if _, errs := l.LoadCertificates(context.Background()); len(errs) != 1 || errs[0].Type != ErrTypePassword {
+		t.Fatalf("expected a password_error, got %v", errs)
+	}
+
+	// Fixing the password alone is enough, the keystore did not change
+	writeFile(t, filepath.Dir(pwFile), "password", []byte("s3cret"))
+	certs, errs := l.LoadCertificates(context.Background())
+	if len(errs) != 0 || len(certs) != 2 {
+		t.Fatalf("expected the keystore to be reloaded, got %d certs and %v", len(certs), errs)
+	}
+}
+
+func TestIsPKCS12(t *testing.T) {
+	if !isPKCS12(generateTestPKCS12(t, "x")) {
+		t.Error("expected a keystore to be detected")
+	}
+	if isPKCS12(generateTestCertDER(t, "a", time.Now(), time.Now().Add(time.Hour))) {
+		t.Error("expected a DER certificate not to be taken for a keystore")
+	}
+	buf := make([]byte, 64)
+	_, _ = rand.Read(buf)
+	if isPKCS12(buf) {
+		t.Error("expected random bytes not to be taken for a keystore")
+	}
+}
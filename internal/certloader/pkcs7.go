@@ -0,0 +1,58 @@
+package certloader
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+var oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+// pkcs7PEMTypes are the PEM armours used for PKCS#7 bundles: OpenSSL writes
+// "PKCS7", Windows and some CAs the RFC 7468 label.
+var pkcs7PEMTypes = []string{"PKCS7", "PKCS #7 SIGNED DATA"}
+
+// pkcs7ContentInfo is a ContentInfo (RFC 2315) holding a SignedData.
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// pkcs7SignedData only decodes what a certificate bundle (.p7b, .p7c) needs:
+// the certificates. Signatures and CRLs are ignored.
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+func isPKCS7(data []byte) bool {
+	var ci pkcs7ContentInfo
+	rest, err := asn1.Unmarshal(data, &ci)
+	return err == nil && len(rest) == 0 && ci.ContentType.Equal(oidSignedData)
+}
+
+// decodePKCS7 returns the certificates of a PKCS#7 SignedData bundle, in the
+// order they are stored.
+func decodePKCS7(der []byte) ([]*x509.Certificate, error) {
+	var ci pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("PKCS#7 content info: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("PKCS#7 content type %s is not signed data", ci.ContentType)
+	}
+
+	var sd pkcs7SignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("PKCS#7 signed data: %w", err)
+	}
+	if len(sd.Certificates.Bytes) == 0 {
+		return nil, errors.New("PKCS#7 bundle holds no certificate")
+	}
+	return x509.ParseCertificates(sd.Certificates.Bytes)
+}
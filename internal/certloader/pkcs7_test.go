@@ -0,0 +1,104 @@
+package certloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// encodeTestPKCS7 builds a degenerate SignedData, as `openssl crl2pkcs7 -nocrl` does.
+func encodeTestPKCS7(t *testing.T, certs ...*x509.Certificate) []byte {
+	t.Helper()
+	var raw bytes.Buffer
+	for _, c := range certs {
+		raw.Write(c.Raw)
+	}
+	emptySet := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true}
+	data, err := asn1.Marshal(struct{ ContentType asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := asn1.Marshal(pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: emptySet,
+		ContentInfo:      asn1.RawValue{FullBytes: data},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw.Bytes()},
+		CRLs:             asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true},
+		SignerInfos:      emptySet,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestFileLoader_PKCS7(t *testing.T) {
+	now := time.Now()
+	ca := issueTestCert(t, "P7 CA", nil, true, now.Add(-time.Hour), now.Add(time.Hour))
+	leaf := issueTestCert(t, "p7.example.com", ca, false, now.Add(-time.Hour), now.Add(time.Hour))
+	der := encodeTestPKCS7(t, leaf.cert, ca.cert)
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"chain.p7c":     der,
+		"chain.p7b":     pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: der}),
+		"rfc7468.p7b":   pem.EncodeToMemory(&pem.Block{Type: "PKCS #7 SIGNED DATA", Bytes: der}),
+		"mixed.pem":     append(pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: der}), generateTestCert(t, "extra", now, now.Add(time.Hour))...),
+		"truncated.p7b": pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: der[:len(der)/2]}),
+	}
+	want := map[string][]string{
+		"chain.p7c":   {"p7.example.com", "P7 CA"},
+		"chain.p7b":   {"p7.example.com", "P7 CA"},
+		"rfc7468.p7b": {"p7.example.com", "P7 CA"},
+		"mixed.pem":   {"p7.example.com", "P7 CA", "extra"},
+	}
+
+	for name, data := range files {
+		t.Run(name, func(t *testing.T) {
+			certs, errs := NewFileLoader(writeFile(t, dir, name, data), slog.Default()).LoadCertificates(context.Background())
+			if name == "truncated.p7b" {
+				if len(certs) != 0 || len(errs) != 1 || errs[0].Type != ErrTypeParse {
+					t.Fatalf("expected a single parse_error, got %d certs and %v", len(certs), errs)
+				}
+				return
+			}
+			if len(errs) != 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			if len(certs) != len(want[name]) {
+				t.Fatalf("expected %v, got %v", want[name], commonNames(certs))
+			}
+			for i, cn := range want[name] {
+				if certs[i].CommonName != cn {
+					t.Errorf("cert %d: expected %s, got %s", i, cn, certs[i].CommonName)
+				}
+			}
+		})
+	}
+}
+
+func TestIsPKCS7(t *testing.T) {
+	now := time.Now()
+	ca := issueTestCert(t, "CA", nil, true, now.Add(-time.Hour), now.Add(time.Hour))
+	if !isPKCS7(encodeTestPKCS7(t, ca.cert)) {
+		t.Error("expected a PKCS#7 bundle to be detected")
+	}
+	if isPKCS7(ca.cert.Raw) {
+		t.Error("expected a DER certificate not to be taken for a PKCS#7 bundle")
+	}
+	if _, err := decodePKCS7(encodeTestPKCS7(t)); err == nil {
+		t.Error("expected an error for a bundle without certificates")
+	}
+}
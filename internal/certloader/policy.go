@@ -0,0 +1,96 @@
+package certloader
+
+import (
+	"bytes"
+	"crypto/x509"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Policy rules, the values of the rule label of x509_cert_policy_violation.
+const (
+	RuleWeakSignature = "weak_signature" // signed with a broken hash (MD5, SHA-1...)
+	RuleRSAKeySize    = "rsa_key_size"   // RSA key under MinRSABits
+	RuleECKeySize     = "ec_key_size"    // ECDSA curve under MinECBits
+	RuleMaxValidity   = "max_validity"   // leaf valid for longer than MaxValidity
+)
+
+// PolicyRules returns every rule name, sorted.
+func PolicyRules() []string {
+	return []string{RuleECKeySize, RuleMaxValidity, RuleRSAKeySize, RuleWeakSignature}
+}
+
+// Policy flags certificates using weak cryptography or breaking the CA/B
+// Forum limits. Rules are skipped when Disabled or when their threshold is
+// zero.
+type Policy struct {
+	WeakHashes  []string      // e.g. MD5, SHA1; matched against SignatureAlgorithm
+	MinRSABits  int           // e.g. 2048
+	MinECBits   int           // e.g. 256, rejects P-224
+	MaxValidity time.Duration // leaf certificates only, 398 days for public TLS
+	Disabled    []string      // rule names
+}
+
+// DefaultPolicy follows the CA/B Forum baseline requirements.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		WeakHashes:  []string{"MD2", "MD5", "SHA1"},
+		MinRSABits:  2048,
+		MinECBits:   256,
+		MaxValidity: 398 * 24 * time.Hour,
+	}
+}
+
+// Check sets Violations on every cert, replacing what an earlier check found.
+func (p *Policy) Check(certs []*CertInfo) {
+	for _, c := range certs {
+		c.Violations = p.violations(c)
+	}
+}
+
+func (p *Policy) violations(c *CertInfo) []string {
+	var rules []string
+	if p.enabled(RuleWeakSignature) && p.weakSignature(c) {
+		rules = append(rules, RuleWeakSignature)
+	}
+	if p.enabled(RuleRSAKeySize) && p.MinRSABits > 0 &&
+		c.KeyAlgorithm == x509.RSA.String() && c.KeySize > 0 && c.KeySize < p.MinRSABits {
+		rules = append(rules, RuleRSAKeySize)
+	}
+	if p.enabled(RuleECKeySize) && p.MinECBits > 0 &&
+		c.KeyAlgorithm == x509.ECDSA.String() && c.KeySize > 0 && c.KeySize < p.MinECBits {
+		rules = append(rules, RuleECKeySize)
+	}
+	if p.enabled(RuleMaxValidity) && p.MaxValidity > 0 && !c.IsCA && c.NotAfter.Sub(c.NotBefore) > p.MaxValidity {
+		rules = append(rules, RuleMaxValidity)
+	}
+	return rules
+}
+
+func (p *Policy) enabled(rule string) bool {
+	return !slices.Contains(p.Disabled, rule)
+}
+
+// weakSignature reports whether c is signed with one of WeakHashes. The
+// signature of a self-issued root is never checked by clients, so it does
+// not count. Go refuses to verify SHA-1 signatures: names are compared.
+func (p *Policy) weakSignature(c *CertInfo) bool {
+	weak := false
+	for _, part := range strings.Split(c.SignatureAlgorithm, "-") {
+		for _, h := range p.WeakHashes {
+			weak = weak || strings.EqualFold(part, normalizeHash(h))
+		}
+	}
+	if !weak || len(c.Raw) == 0 {
+		return weak
+	}
+	cert, err := x509.ParseCertificate(c.Raw)
+	return err != nil || !bytes.Equal(cert.RawIssuer, cert.RawSubject)
+}
+
+// normalizeHash returns a hash name as found in signature algorithm names:
+// "sha-1" -> "SHA1".
+func normalizeHash(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", ""))
+}
@@ -0,0 +1,79 @@
+package certloader
+
+import (
+	"crypto/x509"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	now := time.Now()
+	root := issueTestCert(t, "Root", nil, true, now, now.Add(20*365*24*time.Hour))
+	leaf := issueTestCert(t, "leaf", root, false, now, now.Add(90*24*time.Hour))
+
+	info := func(mod func(*CertInfo)) *CertInfo {
+		c := newCertInfo("/a.pem", leaf.cert)
+		mod(c)
+		return c
+	}
+	tests := []struct {
+		name string
+		cert *CertInfo
+		want []string
+	}{
+		{"compliant", info(func(c *CertInfo) {}), nil},
+		{"sha1", info(func(c *CertInfo) { c.SignatureAlgorithm = x509.SHA1WithRSA.String() }), []string{RuleWeakSignature}},
+		{"md5", info(func(c *CertInfo) { c.SignatureAlgorithm = x509.MD5WithRSA.String() }), []string{RuleWeakSignature}},
+		{"ecdsa sha1", info(func(c *CertInfo) { c.SignatureAlgorithm = x509.ECDSAWithSHA1.String() }), []string{RuleWeakSignature}},
+		{"sha1 root", func() *CertInfo {
+			c := newCertInfo("/root.pem", root.cert)
+			c.SignatureAlgorithm = x509.SHA1WithRSA.String()
+			return c
+		}(), nil},
+		{"rsa 1024", info(func(c *CertInfo) { c.KeyAlgorithm, c.KeySize = "RSA", 1024 }), []string{RuleRSAKeySize}},
+		{"rsa 2048", info(func(c *CertInfo) { c.KeyAlgorithm, c.KeySize = "RSA", 2048 }), nil},
+		{"p-224", info(func(c *CertInfo) { c.KeySize = 224 }), []string{RuleECKeySize}},
+		{"two years", info(func(c *CertInfo) { c.NotAfter = c.NotBefore.Add(2 * 365 * 24 * time.Hour) }), []string{RuleMaxValidity}},
+		{"long lived ca", newCertInfo("/root.pem", root.cert), nil},
+		{"everything", info(func(c *CertInfo) {
+			c.SignatureAlgorithm, c.KeyAlgorithm, c.KeySize = x509.SHA1WithRSA.String(), "RSA", 1024
+			c.NotAfter = c.NotBefore.Add(5 * 365 * 24 * time.Hour)
+		}), []string{RuleWeakSignature, RuleRSAKeySize, RuleMaxValidity}},
+	}
+
+	certs := make([]*CertInfo, 0, len(tests))
+	for _, tc := range tests {
+		certs = append(certs, tc.cert)
+	}
+	DefaultPolicy().Check(certs)
+	for _, tc := range tests {
+		if fmt.Sprint(tc.cert.Violations) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, tc.cert.Violations)
+		}
+	}
+}
+
+func TestPolicy_Thresholds(t *testing.T) {
+	now := time.Now()
+	c := &CertInfo{
+		SignatureAlgorithm: x509.SHA256WithRSA.String(),
+		KeyAlgorithm:       "RSA",
+		KeySize:            2048,
+		NotBefore:          now,
+		NotAfter:           now.Add(200 * 24 * time.Hour),
+	}
+
+	p := &Policy{WeakHashes: []string{"sha-256"}, MinRSABits: 3072, MaxValidity: 90 * 24 * time.Hour}
+	p.Check([]*CertInfo{c})
+	if want := "[weak_signature rsa_key_size max_validity]"; fmt.Sprint(c.Violations) != want {
+		t.Errorf("expected %s, got %v", want, c.Violations)
+	}
+
+	// A later check replaces the earlier result
+	p.Disabled = []string{RuleWeakSignature, RuleMaxValidity}
+	p.Check([]*CertInfo{c})
+	if want := "[rsa_key_size]"; fmt.Sprint(c.Violations) != want {
+		t.Errorf("expected %s, got %v", want, c.Violations)
+	}
+}
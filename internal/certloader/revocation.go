@@ -0,0 +1,281 @@
+package certloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// Cache lifetime of CRLs and OCSP responses without nextUpdate
+	DefaultRevocationTTL = time.Hour
+
+	// CRLs of large public CAs reach tens of MB
+	maxRevocationResponseSize = 64 << 20
+)
+
+// Revocation methods, also used as metric label values.
+const (
+	RevocationOCSP = "ocsp"
+	RevocationCRL  = "crl"
+)
+
+type RevocationStatus struct {
+	Checked   bool // a responder or CRL answered for this cert
+	Revoked   bool
+	RevokedAt time.Time
+	Method    string         // method that answered, RevocationOCSP or RevocationCRL
+	Errors    map[string]int // failed lookups by method
+}
+
+// RevocationChecker looks certs up in the OCSP responders (AIA extension) and
+// CRL distribution points they advertise. Answers are cached until their
+// nextUpdate, and dropped after it, so it is meant to be shared by every
+// source. Safe for concurrent use.
+type RevocationChecker struct {
+	Client *http.Client
+	Clock  func() time.Time
+	Logger *slog.Logger
+
+	mu   sync.Mutex
+	crls map[string]*cachedCRL  // by distribution point URL
+	ocsp map[string]*cachedOCSP // by responder URL and serial
+}
+
+type cachedCRL struct {
+	list    *x509.RevocationList
+	revoked map[string]time.Time // serial (hex) -> revocation time
+	expires time.Time
+}
+
+type cachedOCSP struct {
+	resp    *ocsp.Response
+	expires time.Time
+}
+
+func NewRevocationChecker(timeout time.Duration, logger *slog.Logger) *RevocationChecker {
+	return &RevocationChecker{
+		Client: &http.Client{Timeout: timeout},
+		Clock:  time.Now,
+		Logger: logger,
+		crls:   make(map[string]*cachedCRL),
+		ocsp:   make(map[string]*cachedOCSP),
+	}
+}
+
+// Check sets Revocation on every cert advertising an OCSP responder or a CRL
+// distribution point. OCSP is asked first; CRLs are only fetched when no
+// responder gave a definite answer. The issuer is looked up in the same
+// bundle: without it OCSP is skipped, which counts as an OCSP error, and CRL
+// signatures are not verified.
+func (c *RevocationChecker) Check(ctx context.Context, certs []*CertInfo) {
+	c.evict(c.Clock())
+	for _, b := range bundles(certs) {
+		for i, cert := range b.certs {
+			if len(cert.OCSPServer) == 0 && len(cert.CRLDistributionPoints) == 0 {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			var issuer *x509.Certificate
+			for _, candidate := range b.certs {
+				if issuedBy(cert, candidate) {
+					issuer = candidate
+					break
+				}
+			}
+			b.infos[i].Revocation = c.check(ctx, b.infos[i].FilePath, cert, issuer)
+		}
+	}
+}
+
+func (c *RevocationChecker) check(ctx context.Context, path string, cert, issuer *x509.Certificate) *RevocationStatus {
+	status := &RevocationStatus{}
+	fail := func(method, url string, err error) {
+		if status.Errors == nil {
+			status.Errors = make(map[string]int)
+		}
+		status.Errors[method]++
+		c.Logger.Warn("Revocation check failed", "path", path, "serial", cert.SerialNumber.Text(16),
+			"method", method, "url", url, "error", err)
+	}
+
+	if issuer == nil && len(cert.OCSPServer) > 0 {
+		fail(RevocationOCSP, cert.OCSPServer[0], errors.New("issuer not in the bundle, OCSP skipped"))
+	} else if issuer != nil {
+		for _, url := range cert.OCSPServer {
+			resp, err := c.queryOCSP(ctx, url, cert, issuer)
+			if err != nil {
+				fail(RevocationOCSP, url, err)
+				continue
+			}
+			switch resp.Status {
+			case ocsp.Good:
+				status.Checked, status.Method = true, RevocationOCSP
+				return status
+			case ocsp.Revoked:
+				status.Checked, status.Revoked, status.Method, status.RevokedAt = true, true, RevocationOCSP, resp.RevokedAt
+				return status
+			}
+			// ocsp.Unknown: the responder does not know the cert, try the CRL
+		}
+	}
+
+	for _, url := range cert.CRLDistributionPoints {
+		crl, err := c.fetchCRL(ctx, url, cert, issuer)
+		if err != nil {
+			fail(RevocationCRL, url, err)
+			continue
+		}
+		status.Checked, status.Method = true, RevocationCRL
+		if at, ok := crl.revoked[cert.SerialNumber.Text(16)]; ok {
+			status.Revoked, status.RevokedAt = true, at
+		}
+		return status
+	}
+	return status
+}
+
+func (c *RevocationChecker) queryOCSP(ctx context.Context, url string, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	key := url + "|" + string(issuer.RawSubjectPublicKeyInfo) + "|" + cert.SerialNumber.Text(16)
+	now := c.Clock()
+
+	c.mu.Lock()
+	cached, ok := c.ocsp[key]
+	c.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.resp, nil
+	}
+
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.post(ctx, url, "application/ocsp-request", req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("parse OCSP response: %w", err)
+	}
+
+	c.mu.Lock()
+	c.ocsp[key] = &cachedOCSP{resp: resp, expires: nextUpdate(resp.NextUpdate, now)}
+	c.mu.Unlock()
+	return resp, nil
+}
+
+func (c *RevocationChecker) fetchCRL(ctx context.Context, url string, cert, issuer *x509.Certificate) (*cachedCRL, error) {
+	now := c.Clock()
+
+	c.mu.Lock()
+	cached, ok := c.crls[url]
+	c.mu.Unlock()
+
+	if !ok || !now.Before(cached.expires) {
+		body, err := c.get(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		list, err := ParseCRL(body)
+		if err != nil {
+			return nil, err
+		}
+		cached = newCachedCRL(list, now)
+
+		c.mu.Lock()
+		c.crls[url] = cached
+		c.mu.Unlock()
+	}
+
+	// One CRL may be shared by several issuers' certs: check it per cert
+	if !bytes.Equal(cached.list.RawIssuer, cert.RawIssuer) {
+		return nil, fmt.Errorf("CRL issued by %q, not by the certificate issuer", cached.list.Issuer)
+	}
+	if issuer != nil {
+		if err := cached.list.CheckSignatureFrom(issuer); err != nil {
+			return nil, fmt.Errorf("CRL signature: %w", err)
+		}
+	}
+	return cached, nil
+}
+
+// evict drops the answers past their nextUpdate, so that the caches do not
+// keep growing as certs rotate.
+func (c *RevocationChecker) evict(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	maps.DeleteFunc(c.ocsp, func(_ string, e *cachedOCSP) bool { return !now.Before(e.expires) })
+	maps.DeleteFunc(c.crls, func(_ string, e *cachedCRL) bool { return !now.Before(e.expires) })
+}
+
+func newCachedCRL(list *x509.RevocationList, now time.Time) *cachedCRL {
+	revoked := make(map[string]time.Time, len(list.RevokedCertificateEntries))
+	for _, e := range list.RevokedCertificateEntries {
+		revoked[e.SerialNumber.Text(16)] = e.RevocationTime
+	}
+	return &cachedCRL{list: list, revoked: revoked, expires: nextUpdate(list.NextUpdate, now)}
+}
+
+// ParseCRL parses a DER or PEM ("X509 CRL") certificate revocation list.
+func ParseCRL(data []byte) (*x509.RevocationList, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "X509 CRL" {
+			return nil, fmt.Errorf("unexpected PEM block %q, want X509 CRL", block.Type)
+		}
+		data = block.Bytes
+	}
+	return x509.ParseRevocationList(data)
+}
+
+// nextUpdate returns when an answer published at now stops being cacheable.
+func nextUpdate(next, now time.Time) time.Time {
+	if next.IsZero() {
+		return now.Add(DefaultRevocationTTL)
+	}
+	return next
+}
+
+func (c *RevocationChecker) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+func (c *RevocationChecker) post(ctx context.Context, url, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.do(req)
+}
+
+func (c *RevocationChecker) do(req *http.Request) ([]byte, error) {
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxRevocationResponseSize))
+}
@@ -0,0 +1,230 @@
+package certloader
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// revocationCA is a CA serving its own OCSP responder and CRL.
+type revocationCA struct {
+	*testIssuer
+	revoked map[int64]time.Time
+
+	ocspHits atomic.Int32
+	crlHits  atomic.Int32
+	ocspDown atomic.Bool
+
+	ocspURL string
+	crlURL  string
+}
+
+func newRevocationCA(t *testing.T) *revocationCA {
+	t.Helper()
+	now := time.Now()
+	ca := &revocationCA{
+		testIssuer: issueTestCert(t, "Revocation CA", nil, true, now.Add(-time.Hour), now.Add(24*time.Hour)),
+		revoked:    make(map[int64]time.Time),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ocsp", func(w http.ResponseWriter, r *http.Request) {
+		ca.ocspHits.Add(1)
+		if ca.ocspDown.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tmpl := ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}
+		if at, ok := ca.revoked[req.SerialNumber.Int64()]; ok {
+			tmpl.Status, tmpl.RevokedAt = ocsp.Revoked, at
+		}
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, tmpl, ca.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(resp)
+	})
+	mux.HandleFunc("/ca.crl", func(w http.ResponseWriter, r *http.Request) {
+		ca.crlHits.Add(1)
+		tmpl := &x509.RevocationList{
+			Number:     big.NewInt(1),
+			ThisUpdate: time.Now().Add(-time.Minute),
+			NextUpdate: time.Now().Add(time.Hour),
+		}
+		for serial, at := range ca.revoked {
+			tmpl.RevokedCertificateEntries = append(tmpl.RevokedCertificateEntries,
+				x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: at})
+		}
+		crl, err := x509.CreateRevocationList(rand.Reader, tmpl, ca.cert, ca.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(crl)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	ca.ocspURL, ca.crlURL = srv.URL+"/ocsp", srv.URL+"/ca.crl"
+	return ca
+}
+
+// issue signs a leaf advertising the CA's OCSP responder and/or CRL.
+func (ca *revocationCA) issue(t *testing.T, serial int64, withOCSP, withCRL bool) *CertInfo {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if withOCSP {
+		tmpl.OCSPServer = []string{ca.ocspURL}
+	}
+	if withCRL {
+		tmpl.CRLDistributionPoints = []string{ca.crlURL}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return newCertInfo("/bundle.pem", cert)
+}
+
+func (ca *revocationCA) info() *CertInfo {
+	return newCertInfo("/bundle.pem", ca.cert)
+}
+
+func TestRevocationChecker_OCSP(t *testing.T) {
+	ca := newRevocationCA(t)
+	revokedAt := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	ca.revoked[2] = revokedAt
+
+	good := ca.issue(t, 1, true, true)
+	revoked := ca.issue(t, 2, true, true)
+	checker := NewRevocationChecker(5*time.Second, slog.Default())
+
+	certs := []*CertInfo{good, ca.info()}
+	checker.Check(context.Background(), certs)
+	if r := good.Revocation; r == nil || !r.Checked || r.Revoked || r.Method != RevocationOCSP {
+		t.Fatalf("expected good via OCSP, got %+v", r)
+	}
+	if certs[1].Revocation != nil {
+		t.Errorf("expected the CA (no AIA, no CDP) to be skipped, got %+v", certs[1].Revocation)
+	}
+
+	checker.Check(context.Background(), []*CertInfo{revoked, ca.info()})
+	if r := revoked.Revocation; r == nil || !r.Revoked || r.Method != RevocationOCSP || !r.RevokedAt.Equal(revokedAt) {
+		t.Fatalf("expected revoked via OCSP at %s, got %+v", revokedAt, r)
+	}
+	if ca.crlHits.Load() != 0 {
+		t.Errorf("expected no CRL fetch when OCSP answers, got %d", ca.crlHits.Load())
+	}
+
+	// Answers are cached until nextUpdate
+	checker.Check(context.Background(), []*CertInfo{good, ca.info()})
+	if got := ca.ocspHits.Load(); got != 2 {
+		t.Errorf("expected 2 OCSP requests, got %d", got)
+	}
+	checker.Clock = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	checker.Check(context.Background(), []*CertInfo{good, ca.info()})
+	if got := ca.ocspHits.Load(); got != 3 {
+		t.Errorf("expected a new OCSP request after nextUpdate, got %d", got)
+	}
+	if got := len(checker.ocsp); got != 1 {
+		t.Errorf("expected the expired answer for the revoked cert to be evicted, got %d cached", got)
+	}
+}
+
+func TestRevocationChecker_CRL(t *testing.T) {
+	ca := newRevocationCA(t)
+	ca.revoked[2] = time.Now().Add(-time.Minute)
+	checker := NewRevocationChecker(5*time.Second, slog.Default())
+
+	good := ca.issue(t, 1, false, true)
+	revoked := ca.issue(t, 2, false, true)
+	checker.Check(context.Background(), []*CertInfo{good, revoked, ca.info()})
+
+	if r := good.Revocation; r == nil || !r.Checked || r.Revoked || r.Method != RevocationCRL {
+		t.Fatalf("expected good via CRL, got %+v", r)
+	}
+	if r := revoked.Revocation; r == nil || !r.Revoked || r.Method != RevocationCRL {
+		t.Fatalf("expected revoked via CRL, got %+v", r)
+	}
+	if got := ca.crlHits.Load(); got != 1 {
+		t.Errorf("expected the CRL to be fetched once, got %d", got)
+	}
+
+	// Without the issuer in the bundle the CRL is still used, unverified, and
+	// the skipped OCSP check is counted
+	alone := ca.issue(t, 2, true, true)
+	checker.Check(context.Background(), []*CertInfo{alone})
+	if r := alone.Revocation; r == nil || !r.Revoked || r.Method != RevocationCRL || r.Errors[RevocationOCSP] != 1 {
+		t.Fatalf("expected revoked via CRL without issuer and one OCSP error, got %+v", r)
+	}
+	if got := ca.ocspHits.Load(); got != 0 {
+		t.Errorf("expected no OCSP request without the issuer, got %d", got)
+	}
+}
+
+func TestRevocationChecker_Errors(t *testing.T) {
+	ca := newRevocationCA(t)
+	ca.ocspDown.Store(true)
+	checker := NewRevocationChecker(5*time.Second, slog.Default())
+
+	// OCSP down: the CRL answers, the failure is counted
+	leaf := ca.issue(t, 1, true, true)
+	checker.Check(context.Background(), []*CertInfo{leaf, ca.info()})
+	if r := leaf.Revocation; r == nil || !r.Checked || r.Method != RevocationCRL || r.Errors[RevocationOCSP] != 1 {
+		t.Fatalf("expected CRL fallback with one OCSP error, got %+v", r)
+	}
+
+	// Nothing answers
+	leaf = ca.issue(t, 1, true, false)
+	checker.Check(context.Background(), []*CertInfo{leaf, ca.info()})
+	if r := leaf.Revocation; r == nil || r.Checked || r.Errors[RevocationOCSP] != 1 {
+		t.Fatalf("expected an unchecked status with one OCSP error, got %+v", r)
+	}
+
+	// A CRL signed by another CA is rejected
+	other := newRevocationCA(t)
+	leaf = ca.issue(t, 1, false, false)
+	cert, _ := x509.ParseCertificate(leaf.Raw)
+	cert.CRLDistributionPoints = []string{other.crlURL}
+	if _, err := checker.fetchCRL(context.Background(), other.crlURL, cert, ca.cert); err == nil {
+		t.Fatal("expected an error for a CRL of another issuer")
+	}
+}
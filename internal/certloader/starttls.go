@@ -0,0 +1,291 @@
+package certloader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
+
+// starttlsProtocol upgrades a plain connection so that the next bytes on the
+// wire are the TLS handshake.
+type starttlsProtocol struct {
+	Port    string
+	Upgrade func(conn net.Conn, host string) error
+}
+
+var starttlsProtocols = map[string]starttlsProtocol{
+	"smtp":     {"25", starttlsSMTP},
+	"imap":     {"143", starttlsIMAP},
+	"pop3":     {"110", starttlsPOP3},
+	"ftp":      {"21", starttlsFTP},
+	"ldap":     {"389", starttlsLDAP},
+	"xmpp":     {"5222", starttlsXMPP},
+	"postgres": {"5432", starttlsPostgres},
+}
+
+// StartTLSProtocols returns the supported STARTTLS protocol names, sorted.
+func StartTLSProtocols() []string {
+	names := make([]string, 0, len(starttlsProtocols))
+	for name := range starttlsProtocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// maxStartTLSReply bounds what is read from a server before the upgrade:
+// banners, capabilities and the upgrade answer fit in a few KiB.
+const maxStartTLSReply = 8 << 10
+
+var errReplyTooLong = fmt.Errorf("server sent more than %d bytes before the upgrade", maxStartTLSReply)
+
+// replyLimiter fails reads past maxStartTLSReply bytes.
+type replyLimiter struct {
+	r    io.Reader
+	left int
+}
+
+func (l *replyLimiter) Read(p []byte) (int, error) {
+	if l.left <= 0 {
+		return 0, errReplyTooLong
+	}
+	if len(p) > l.left {
+		p = p[:l.left]
+	}
+	n, err := l.r.Read(p)
+	l.left -= n
+	return n, err
+}
+
+// newReplyReader buffers conn, reading at most maxStartTLSReply bytes.
+func newReplyReader(conn net.Conn) *bufio.Reader {
+	return bufio.NewReader(&replyLimiter{r: conn, left: maxStartTLSReply})
+}
+
+// === Line based protocols ===
+
+// readReply reads a (possibly multi-line) SMTP/FTP style reply and checks its code.
+func readReply(r *bufio.Reader, code string) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if len(line) < 4 || line[:3] != code {
+			return fmt.Errorf("unexpected reply, want %s: %q", code, strings.TrimSpace(line))
+		}
+		// "250-" continues, "250 " ends
+		if line[3] != '-' {
+			return nil
+		}
+	}
+}
+
+// readPrefixed reads lines until one starts with prefix, failing on any of bad.
+func readPrefixed(r *bufio.Reader, prefix string, bad ...string) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, prefix) {
+			return nil
+		}
+		for _, b := range bad {
+			if strings.HasPrefix(line, b) {
+				return fmt.Errorf("upgrade refused: %q", strings.TrimSpace(line))
+			}
+		}
+	}
+}
+
+func starttlsSMTP(conn net.Conn, _ string) error {
+	r := newReplyReader(conn)
+	if err := readReply(r, "220"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "EHLO x509-watch\r\n"); err != nil {
+		return err
+	}
+	if err := readReply(r, "250"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "STARTTLS\r\n"); err != nil {
+		return err
+	}
+	return readReply(r, "220")
+}
+
+func starttlsFTP(conn net.Conn, _ string) error {
+	r := newReplyReader(conn)
+	if err := readReply(r, "220"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "AUTH TLS\r\n"); err != nil {
+		return err
+	}
+	return readReply(r, "234")
+}
+
+func starttlsIMAP(conn net.Conn, _ string) error {
+	r := newReplyReader(conn)
+	if err := readPrefixed(r, "* OK", "* BYE"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "a001 STARTTLS\r\n"); err != nil {
+		return err
+	}
+	return readPrefixed(r, "a001 OK", "a001 NO", "a001 BAD")
+}
+
+func starttlsPOP3(conn net.Conn, _ string) error {
+	r := newReplyReader(conn)
+	if err := readPrefixed(r, "+OK", "-ERR"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "STLS\r\n"); err != nil {
+		return err
+	}
+	return readPrefixed(r, "+OK", "-ERR")
+}
+
+// === XMPP ===
+
+func starttlsXMPP(conn net.Conn, host string) error {
+	var to strings.Builder
+	if err := xml.EscapeText(&to, []byte(host)); err != nil {
+		return err
+	}
+	header := fmt.Sprintf("<?xml version='1.0'?><stream:stream to='%s' xmlns='jabber:client' "+
+		"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>", to.String())
+	if _, err := io.WriteString(conn, header); err != nil {
+		return err
+	}
+	r := newReplyReader(conn)
+	if err := readUntil(r, "</stream:features>"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>"); err != nil {
+		return err
+	}
+	return readUntil(r, "<proceed")
+}
+
+// readUntil consumes r until token has been seen.
+func readUntil(r *bufio.Reader, token string) error {
+	var buf []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		buf = append(buf, b)
+		if bytes.HasSuffix(buf, []byte(token)) {
+			return nil
+		}
+		if bytes.HasSuffix(buf, []byte("<failure")) {
+			return fmt.Errorf("upgrade refused by server")
+		}
+	}
+}
+
+// === PostgreSQL ===
+
+const postgresSSLRequestCode = 80877103
+
+func starttlsPostgres(conn net.Conn, _ string) error {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint32(msg[0:4], 8)
+	binary.BigEndian.PutUint32(msg[4:8], postgresSSLRequestCode)
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+	resp := make([]byte, 1)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+	if resp[0] != 'S' {
+		return fmt.Errorf("server refused SSLRequest (%q)", resp[0])
+	}
+	return nil
+}
+
+// === LDAP ===
+
+const ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// ldapStartTLSRequest is LDAPMessage{ messageID 1, ExtendedRequest{ requestName ldapStartTLSOID } }
+var ldapStartTLSRequest = append([]byte{
+	0x30, 0x1d, // SEQUENCE
+	0x02, 0x01, 0x01, // messageID INTEGER 1
+	0x77, 0x18, // [APPLICATION 23] ExtendedRequest
+	0x80, 0x16, // [0] requestName
+}, ldapStartTLSOID...)
+
+func starttlsLDAP(conn net.Conn, _ string) error {
+	if _, err := conn.Write(ldapStartTLSRequest); err != nil {
+		return err
+	}
+	raw, err := readBERElement(conn)
+	if err != nil {
+		return err
+	}
+
+	var msg struct {
+		ID int
+		Op asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(raw, &msg); err != nil {
+		return fmt.Errorf("decode LDAP response: %w", err)
+	}
+	if msg.Op.Class != asn1.ClassApplication || msg.Op.Tag != 24 {
+		return fmt.Errorf("unexpected LDAP response op %d", msg.Op.Tag)
+	}
+	var code asn1.Enumerated
+	if _, err := asn1.Unmarshal(msg.Op.Bytes, &code); err != nil {
+		return fmt.Errorf("decode LDAP result code: %w", err)
+	}
+	if code != 0 {
+		return fmt.Errorf("LDAP StartTLS refused, result code %d", code)
+	}
+	return nil
+}
+
+// readBERElement reads exactly one BER TLV from r.
+func readBERElement(r io.Reader) ([]byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	length := int(head[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 {
+			return nil, fmt.Errorf("unsupported BER length encoding")
+		}
+		lb := make([]byte, n)
+		if _, err := io.ReadFull(r, lb); err != nil {
+			return nil, err
+		}
+		head = append(head, lb...)
+		length = 0
+		for _, b := range lb {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxStartTLSReply {
+		return nil, errReplyTooLong
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return append(head, body...), nil
+}
@@ -0,0 +1,240 @@
+package certloader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTLSCertificate returns a self-signed server certificate for fake servers.
+func testTLSCertificate(t *testing.T, cn string) tls.Certificate {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv}
+}
+
+// fakeStartTLSServer accepts one connection, runs the plain-text part of the
+// protocol and, if it succeeds, completes a TLS handshake.
+func fakeStartTLSServer(t *testing.T, cert tls.Certificate, script func(conn net.Conn, r *bufio.Reader) bool) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if !script(conn, bufio.NewReader(conn)) {
+			return
+		}
+		_ = tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}}).Handshake()
+	}()
+
+	return ln.Addr().String()
+}
+
+// reply writes lines after reading one client line.
+func reply(conn net.Conn, r *bufio.Reader, lines string) bool {
+	if _, err := r.ReadString('\n'); err != nil {
+		return false
+	}
+	_, err := io.WriteString(conn, lines)
+	return err == nil
+}
+
+var starttlsScripts = map[string]func(conn net.Conn, r *bufio.Reader) bool{
+	"smtp": func(conn net.Conn, r *bufio.Reader) bool {
+		io.WriteString(conn, "220-fake.example.com ESMTP\r\n220 ready\r\n")
+		return reply(conn, r, "250-fake.example.com\r\n250 STARTTLS\r\n") &&
+			reply(conn, r, "220 2.0.0 Ready to start TLS\r\n")
+	},
+	"imap": func(conn net.Conn, r *bufio.Reader) bool {
+		io.WriteString(conn, "* OK [CAPABILITY IMAP4rev1 STARTTLS] ready\r\n")
+		return reply(conn, r, "a001 OK Begin TLS negotiation now\r\n")
+	},
+	"pop3": func(conn net.Conn, r *bufio.Reader) bool {
+		io.WriteString(conn, "+OK POP3 ready\r\n")
+		return reply(conn, r, "+OK Begin TLS\r\n")
+	},
+	"ftp": func(conn net.Conn, r *bufio.Reader) bool {
+		io.WriteString(conn, "220-Welcome\r\n220 FTP ready\r\n")
+		return reply(conn, r, "234 AUTH TLS successful\r\n")
+	},
+	"ldap": func(conn net.Conn, r *bufio.Reader) bool {
+		req, err := readBERElement(r)
+		if err != nil || !bytes.Contains(req, []byte(ldapStartTLSOID)) {
+			return false
+		}
+		// ExtendedResponse{ resultCode success, matchedDN "", diagnosticMessage "" }
+		_, err = conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00})
+		return err == nil
+	},
+	"xmpp": func(conn net.Conn, r *bufio.Reader) bool {
+		if readUntil(r, "version='1.0'>") != nil {
+			return false
+		}
+		io.WriteString(conn, "<?xml version='1.0'?><stream:stream xmlns='jabber:client' "+
+			"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'><stream:features>"+
+			"<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'><required/></starttls></stream:features>")
+		if readUntil(r, "/>") != nil {
+			return false
+		}
+		_, err := io.WriteString(conn, "<proceed xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>")
+		return err == nil
+	},
+	"postgres": func(conn net.Conn, r *bufio.Reader) bool {
+		msg := make([]byte, 8)
+		if _, err := io.ReadFull(r, msg); err != nil || binary.BigEndian.Uint32(msg[4:]) != postgresSSLRequestCode {
+			return false
+		}
+		_, err := conn.Write([]byte{'S'})
+		return err == nil
+	},
+}
+
+func TestTLSLoader_StartTLSProtocols(t *testing.T) {
+	for _, proto := range StartTLSProtocols() {
+		t.Run(proto, func(t *testing.T) {
+			script, ok := starttlsScripts[proto]
+			if !ok {
+				t.Fatalf("no fake server for %s", proto)
+			}
+			cn := proto + ".example.com"
+			addr := fakeStartTLSServer(t, testTLSCertificate(t, cn), script)
+
+			loader := NewStartTLSLoader([]string{addr}, proto, 2*time.Second, slog.Default())
+			certs, errs := loader.LoadCertificates(context.Background())
+
+			if len(errs) != 0 {
+				t.Fatalf("expected 0 errors, got %d: %v", len(errs), errs)
+			}
+			if len(certs) != 1 {
+				t.Fatalf("expected 1 cert, got %d", len(certs))
+			}
+			if certs[0].CommonName != cn {
+				t.Errorf("expected CN=%s, got %s", cn, certs[0].CommonName)
+			}
+		})
+	}
+}
+
+func TestTLSLoader_StartTLSRefused(t *testing.T) {
+	tests := map[string]func(conn net.Conn, r *bufio.Reader) bool{
+		"smtp": func(conn net.Conn, r *bufio.Reader) bool {
+			io.WriteString(conn, "220 ready\r\n")
+			reply(conn, r, "250 fake.example.com\r\n")
+			reply(conn, r, "454 4.7.0 TLS not available\r\n")
+			return false
+		},
+		"smtp_endless_banner": func(conn net.Conn, r *bufio.Reader) bool {
+			for range 2 * maxStartTLSReply / 64 {
+				if _, err := io.WriteString(conn, "220-"+strings.Repeat("x", 58)+"\r\n"); err != nil {
+					break
+				}
+			}
+			io.Copy(io.Discard, r) // keep the connection open: only the cap ends the read
+			return false
+		},
+		"xmpp_no_features": func(conn net.Conn, r *bufio.Reader) bool {
+			io.WriteString(conn, "<stream:stream>"+strings.Repeat("<x/>", maxStartTLSReply))
+			io.Copy(io.Discard, r)
+			return false
+		},
+		"ldap_huge_length": func(conn net.Conn, r *bufio.Reader) bool {
+			io.ReadFull(r, make([]byte, len(ldapStartTLSRequest)))
+			conn.Write([]byte{0x30, 0x84, 0x7f, 0xff, 0xff, 0xff})
+			io.Copy(io.Discard, r)
+			return false
+		},
+		"postgres": func(conn net.Conn, r *bufio.Reader) bool {
+			io.ReadFull(r, make([]byte, 8))
+			conn.Write([]byte{'N'})
+			return false
+		},
+	}
+
+	for name, script := range tests {
+		t.Run(name, func(t *testing.T) {
+			addr := fakeStartTLSServer(t, testTLSCertificate(t, "refused.example.com"), script)
+
+			proto, _, _ := strings.Cut(name, "_")
+			loader := NewStartTLSLoader([]string{addr}, proto, 2*time.Second, slog.Default())
+			certs, errs := loader.LoadCertificates(context.Background())
+
+			if len(certs) != 0 {
+				t.Fatalf("expected 0 certs, got %d", len(certs))
+			}
+			if len(errs) != 1 {
+				t.Fatalf("expected 1 error, got %d", len(errs))
+			}
+			if errs[0].Type != ErrTypeStartTLS {
+				t.Fatalf("expected ErrTypeStartTLS, got %s", errs[0].Type)
+			}
+		})
+	}
+}
+
+func TestStartTLSXMPP_EscapesHost(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		_ = starttlsXMPP(client, "a'b<c&d")
+	}()
+
+	r := bufio.NewReader(server)
+	var header []byte
+	for !bytes.HasSuffix(header, []byte("version='1.0'>")) {
+		b, err := r.ReadByte()
+		if err != nil {
+			t.Fatalf("read header: %v", err)
+		}
+		header = append(header, b)
+	}
+	server.Close()
+	if !bytes.Contains(header, []byte("to='a&#39;b&lt;c&amp;d'")) {
+		t.Errorf("expected an escaped host, got %s", header)
+	}
+}
+
+func TestTLSLoader_UnknownStartTLSProtocol(t *testing.T) {
+	loader := NewStartTLSLoader([]string{"127.0.0.1:1"}, "gopher", time.Second, slog.Default())
+	_, errs := loader.LoadCertificates(context.Background())
+
+	if len(errs) != 1 || errs[0].Type != ErrTypeStartTLS {
+		t.Fatalf("expected 1 ErrTypeStartTLS, got %v", errs)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package certloader
+
+import "os"
+
+// No inode outside unix: the cache relies on mtime and size only.
+func inode(os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,145 @@
+package certloader
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTLSPort    = "443"
+	defaultTLSTimeout = 5 * time.Second
+)
+
+// TLSLoader dials live endpoints and reports the certificate chain they serve.
+type TLSLoader struct {
+	Targets  []string // host:port, port defaults to 443 (or the StartTLS protocol port)
+	StartTLS string   // optional protocol upgrade before the handshake, see StartTLSProtocols
+	Timeout  time.Duration
+	Logger   *slog.Logger
+}
+
+func NewTLSLoader(targets []string, timeout time.Duration, logger *slog.Logger) *TLSLoader {
+	if timeout <= 0 {
+		timeout = defaultTLSTimeout
+	}
+	return &TLSLoader{
+		Targets: targets,
+		Timeout: timeout,
+		Logger:  logger,
+	}
+}
+
+// NewStartTLSLoader returns a TLSLoader speaking the given STARTTLS protocol first.
+func NewStartTLSLoader(targets []string, protocol string, timeout time.Duration, logger *slog.Logger) *TLSLoader {
+	l := NewTLSLoader(targets, timeout, logger)
+	l.StartTLS = protocol
+	return l
+}
+
+func (l *TLSLoader) LoadCertificates(ctx context.Context) ([]*CertInfo, []*CertError) {
+	var certs []*CertInfo
+	var errs []*CertError
+
+	for _, target := range l.Targets {
+		if ctx.Err() != nil {
+			errs = append(errs, NewCertError(target, ErrTypeUnknown, ctx.Err()))
+			break
+		}
+
+		cs, err := l.probe(ctx, target)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		certs = append(certs, cs...)
+	}
+
+	return certs, errs
+}
+
+// probe completes a handshake with one target and returns the served chain.
+func (l *TLSLoader) probe(ctx context.Context, target string) ([]*CertInfo, *CertError) {
+	port := defaultTLSPort
+	var upgrade func(net.Conn, string) error
+	if l.StartTLS != "" {
+		proto, ok := starttlsProtocols[l.StartTLS]
+		if !ok {
+			return nil, NewCertError(target, ErrTypeStartTLS, fmt.Errorf("unsupported starttls protocol %q", l.StartTLS))
+		}
+		port, upgrade = proto.Port, proto.Upgrade
+	}
+	addr, host := normalizeTarget(target, port)
+
+	l.Logger.Debug("Probing TLS endpoint", "target", addr, "starttls", l.StartTLS)
+
+	ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, NewCertError(addr, classifyNetError(err, ErrTypeDial), err)
+	}
+	defer conn.Close()
+
+	if upgrade != nil {
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		if err := upgrade(conn, host); err != nil {
+			return nil, NewCertError(addr, classifyNetError(err, ErrTypeStartTLS), err)
+		}
+		_ = conn.SetDeadline(time.Time{})
+	}
+
+	// We want whatever the server presents, trusted or not
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, NewCertError(addr, classifyNetError(err, ErrTypeHandshake), err)
+	}
+
+	peers := tlsConn.ConnectionState().PeerCertificates
+	if len(peers) == 0 {
+		return nil, NewCertError(addr, ErrTypeHandshake, fmt.Errorf("no peer certificates"))
+	}
+
+	certs := make([]*CertInfo, 0, len(peers))
+	for _, cert := range peers {
+		certs = append(certs, newCertInfo(addr, cert))
+	}
+	return certs, nil
+}
+
+// normalizeTarget returns the dial address and the SNI host name for target.
+func normalizeTarget(target, defaultPort string) (addr, host string) {
+	h, _, err := net.SplitHostPort(target)
+	if err != nil {
+		host := target
+		if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+			host = host[1 : len(host)-1] // bracketed IPv6 address
+		}
+		return net.JoinHostPort(host, defaultPort), host
+	}
+	return target, h
+}
+
+// classifyNetError maps deadline/timeout failures to ErrTypeTimeout, fallback otherwise.
+func classifyNetError(err error, fallback CertErrorType) CertErrorType {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTypeTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrTypeTimeout
+	}
+	return fallback
+}
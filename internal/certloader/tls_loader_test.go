@@ -0,0 +1,139 @@
+package certloader
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTLSLoader_ServedChain(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	addr := srv.Listener.Addr().String()
+	loader := NewTLSLoader([]string{addr}, time.Second, slog.Default())
+	certs, errs := loader.LoadCertificates(context.Background())
+
+	if len(errs) != 0 {
+		t.Fatalf("expected 0 errors, got %d: %v", len(errs), errs)
+	}
+	if len(certs) != len(srv.TLS.Certificates[0].Certificate) {
+		t.Fatalf("expected %d certs, got %d", len(srv.TLS.Certificates[0].Certificate), len(certs))
+	}
+	if certs[0].FilePath != addr {
+		t.Errorf("expected filepath=%s, got %s", addr, certs[0].FilePath)
+	}
+	if certs[0].NotAfter.IsZero() {
+		t.Error("expected NotAfter to be set")
+	}
+}
+
+func TestTLSLoader_DialError(t *testing.T) {
+	// Grab a free port then close it so nothing is listening
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	loader := NewTLSLoader([]string{addr}, time.Second, slog.Default())
+	certs, errs := loader.LoadCertificates(context.Background())
+
+	if len(certs) != 0 {
+		t.Fatalf("expected 0 certs, got %d", len(certs))
+	}
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(errs))
+	}
+	if errs[0].Type != ErrTypeDial {
+		t.Fatalf("expected ErrTypeDial, got %s", errs[0].Type)
+	}
+}
+
+func TestTLSLoader_HandshakeError(t *testing.T) {
+	// Plain HTTP server: the TLS ClientHello gets a non-TLS answer
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	loader := NewTLSLoader([]string{srv.Listener.Addr().String()}, time.Second, slog.Default())
+	_, errs := loader.LoadCertificates(context.Background())
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(errs))
+	}
+	if errs[0].Type != ErrTypeHandshake {
+		t.Fatalf("expected ErrTypeHandshake, got %s", errs[0].Type)
+	}
+}
+
+func TestTLSLoader_Timeout(t *testing.T) {
+	// Accept connections but never answer the handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	loader := NewTLSLoader([]string{ln.Addr().String()}, 100*time.Millisecond, slog.Default())
+	_, errs := loader.LoadCertificates(context.Background())
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(errs))
+	}
+	if errs[0].Type != ErrTypeTimeout {
+		t.Fatalf("expected ErrTypeTimeout, got %s", errs[0].Type)
+	}
+}
+
+func TestTLSLoader_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	loader := NewTLSLoader([]string{"127.0.0.1:1", "127.0.0.1:2"}, time.Second, slog.Default())
+	certs, errs := loader.LoadCertificates(ctx)
+
+	if len(certs) != 0 {
+		t.Fatalf("expected 0 certs on cancelled context, got %d", len(certs))
+	}
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(errs))
+	}
+	if errs[0].Type != ErrTypeUnknown {
+		t.Fatalf("expected ErrTypeUnknown, got %s", errs[0].Type)
+	}
+}
+
+func TestNormalizeTarget(t *testing.T) {
+	tests := []struct {
+		target   string
+		wantAddr string
+		wantHost string
+	}{
+		{"example.com", "example.com:443", "example.com"},
+		{"example.com:8443", "example.com:8443", "example.com"},
+		{"[::1]:443", "[::1]:443", "::1"},
+		{"[::1]", "[::1]:443", "::1"},
+		{"::1", "[::1]:443", "::1"},
+	}
+
+	for _, tc := range tests {
+		addr, host := normalizeTarget(tc.target, defaultTLSPort)
+		if addr != tc.wantAddr || host != tc.wantHost {
+			t.Errorf("target=%q: expected (%q, %q), got (%q, %q)", tc.target, tc.wantAddr, tc.wantHost, addr, host)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package certloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultURLTimeout = 10 * time.Second
+	maxURLResponse    = 16 << 20
+)
+
+// URLLoader fetches certificates and CA bundles published over HTTP(S), e.g.
+// AIA caIssuers or artifact servers, and parses them like FileLoader. Answers
+// are revalidated with ETag and Last-Modified, so unchanged documents are
+// neither downloaded nor parsed again.
+type URLLoader struct {
+	URLs    []string
+	Timeout time.Duration // per URL, connection to end of body
+	Logger  *slog.Logger
+
+	// Built on first use from Timeout
+	Client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]*urlEntry
+}
+
+// urlEntry is the last successful answer of a URL.
+type urlEntry struct {
+	etag         string
+	lastModified string
+	certs        []*CertInfo
+	errs         []*CertError
+}
+
+func NewURLLoader(urls []string, timeout time.Duration, logger *slog.Logger) *URLLoader {
+	if timeout <= 0 {
+		timeout = defaultURLTimeout
+	}
+	return &URLLoader{
+		URLs:    urls,
+		Timeout: timeout,
+		Logger:  logger,
+	}
+}
+
+// ValidateURL checks a URL source entry: absolute, http or https, with a host.
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", raw, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q: http(s)://host/... expected", raw)
+	}
+	return nil
+}
+
+func (l *URLLoader) LoadCertificates(ctx context.Context) ([]*CertInfo, []*CertError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.Client == nil {
+		l.Client = &http.Client{Timeout: l.Timeout}
+	}
+	if l.cache == nil {
+		l.cache = make(map[string]*urlEntry)
+	}
+
+	var certs []*CertInfo
+	var errs []*CertError
+	for _, u := range l.URLs {
+		if ctx.Err() != nil {
+			errs = append(errs, NewCertError(u, ErrTypeUnknown, ctx.Err()))
+			break
+		}
+
+		entry, err := l.fetch(ctx, u)
+		if err != nil {
+			errs = append(errs, NewCertError(u, ErrTypeFetch, err))
+			continue
+		}
+		for _, c := range entry.certs {
+			certs = append(certs, c.clone())
+		}
+		errs = append(errs, entry.errs...)
+	}
+	return certs, errs
+}
+
+// fetch returns the current content of u, from the cache when the server
+// answers 304 Not Modified.
+func (l *URLLoader) fetch(ctx context.Context, u string) (*urlEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	cached := l.cache[u]
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	l.Logger.Debug("Fetching certificates", "url", u)
+	resp, err := l.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		l.Logger.Debug("Certificates not modified", "url", u)
+		return cached, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxURLResponse+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxURLResponse {
+		return nil, errors.New("response too large")
+	}
+
+	certs, errs := parseCertificates(u, data, nil, l.Logger)
+	if len(certs) == 0 && len(errs) == 0 {
+		// parseCertificates skips CRLs, expected next to certificates in a
+		// directory but not as the whole document
+		if _, err := ParseCRL(data); err == nil {
+			errs = []*CertError{NewCertError(u, ErrTypeParse, errors.New("got a CRL, not certificates"))}
+		}
+	}
+	entry := &urlEntry{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		certs:        certs,
+		errs:         errs,
+	}
+	if entry.etag != "" || entry.lastModified != "" {
+		l.cache[u] = entry
+	} else {
+		delete(l.cache, u)
+	}
+	return entry, nil
+}
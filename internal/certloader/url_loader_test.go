@@ -0,0 +1,119 @@
+package certloader
+
+import (
+	"context"
+	"encoding/pem"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestURLLoader_ConditionalRequests(t *testing.T) {
+	now := time.Now()
+	bundle := append(generateTestCert(t, "root", now, now.Add(time.Hour)), generateTestCert(t, "intermediate", now, now.Add(time.Hour))...)
+	der := generateTestCertDER(t, "issuer", now, now.Add(time.Hour))
+	modified := now.UTC().Format(http.TimeFormat)
+
+	var downloads atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bundle.pem", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write(bundle)
+	})
+	mux.HandleFunc("/issuer.crt", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Modified-Since") == modified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads.Add(1)
+		w.Header().Set("Last-Modified", modified)
+		_, _ = w.Write(der)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	l := NewURLLoader([]string{srv.URL + "/bundle.pem", srv.URL + "/issuer.crt"}, time.Second, slog.Default())
+	for i := 0; i < 2; i++ {
+		certs, errs := l.LoadCertificates(context.Background())
+		if len(errs) != 0 {
+			t.Fatalf("scan %d: unexpected errors: %v", i, errs)
+		}
+		names := commonNames(certs)
+		if len(certs) != 3 || !names["root"] || !names["intermediate"] || !names["issuer"] {
+			t.Fatalf("scan %d: expected root, intermediate and issuer, got %v", i, names)
+		}
+		if certs[2].FilePath != srv.URL+"/issuer.crt" {
+			t.Errorf("scan %d: unexpected filepath %s", i, certs[2].FilePath)
+		}
+		certs[0].Labels = map[string]string{"source": "x"} // must not leak into the cache
+	}
+	if n := downloads.Load(); n != 2 {
+		t.Errorf("expected each URL to be downloaded once, got %d downloads", n)
+	}
+}
+
+func TestURLLoader_FetchErrors(t *testing.T) {
+	now := time.Now()
+	crl := generateTestCRL(t, issueTestCert(t, "CA", nil, true, now, now.Add(time.Hour)), 1, now, now.Add(time.Hour))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	})
+	mux.HandleFunc("/garbage", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/ca.crl", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(crl)
+	})
+	mux.HandleFunc("/ca.crl.pem", func(w http.ResponseWriter, r *http.Request) {
+		_ = pem.Encode(w, &pem.Block{Type: "X509 CRL", Bytes: crl})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := map[string]struct {
+		url  string
+		want CertErrorType
+		msg  string
+	}{
+		"status":  {srv.URL + "/missing", ErrTypeFetch, "404"},
+		"timeout": {srv.URL + "/slow", ErrTypeFetch, "Timeout"},
+		"refused": {"http://127.0.0.1:1/ca.pem", ErrTypeFetch, "refused"},
+		"parse":   {srv.URL + "/garbage", ErrTypePEM, ""},
+		"crl_der": {srv.URL + "/ca.crl", ErrTypeParse, "got a CRL"},
+		"crl_pem": {srv.URL + "/ca.crl.pem", ErrTypeParse, "got a CRL"},
+	}
+	for name, tc := range tests {
+		certs, errs := NewURLLoader([]string{tc.url}, 200*time.Millisecond, slog.Default()).LoadCertificates(context.Background())
+		if len(certs) != 0 || len(errs) != 1 || errs[0].Type != tc.want || !strings.Contains(errs[0].Error(), tc.msg) {
+			t.Errorf("%s: expected a %s containing %q, got %d certs and %v", name, tc.want, tc.msg, len(certs), errs)
+		}
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	for _, u := range []string{"https://pki.example.com/ca.pem", "http://10.0.0.1:8080/bundle"} {
+		if err := ValidateURL(u); err != nil {
+			t.Errorf("%q: unexpected error %v", u, err)
+		}
+	}
+	for _, u := range []string{"", "pki.example.com/ca.pem", "ftp://pki/ca.pem", "https:///ca.pem", "http://[::1"} {
+		if err := ValidateURL(u); err == nil {
+			t.Errorf("%q: expected an error", u)
+		}
+	}
+}
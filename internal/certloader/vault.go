@@ -0,0 +1,420 @@
+package certloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric labels of certificates read from Vault PKI mounts.
+const (
+	MountLabel  = "mount"
+	SerialLabel = "serial" // same value as CertInfo.SerialNumber
+)
+
+// Vault auth methods.
+const (
+	VaultAuthToken      = "token"
+	VaultAuthAppRole    = "approle"
+	VaultAuthKubernetes = "kubernetes"
+)
+
+const (
+	defaultVaultTimeout = 10 * time.Second
+	maxVaultResponse    = 16 << 20
+)
+
+// VaultAuth selects how VaultLoader gets its token.
+type VaultAuth struct {
+	Method string // VaultAuthToken (default), VaultAuthAppRole or VaultAuthKubernetes
+	Mount  string // auth mount path, defaults to the method name
+
+	// token: Token, else TokenFile (re-read on every scan), else $VAULT_TOKEN
+	Token     string
+	TokenFile string
+
+	// approle: SecretIDFile wins over SecretID
+	RoleID       string
+	SecretID     string
+	SecretIDFile string
+
+	// kubernetes: JWTFile defaults to the pod service account token
+	Role    string
+	JWTFile string
+}
+
+// VaultLoader lists the certificates issued by Vault PKI secrets engines, and
+// their issuers, through the HTTP API. Certificates never change once issued,
+// so each serial is fetched only once; revoked certificates are skipped.
+type VaultLoader struct {
+	Address string   // e.g. https://vault:8200, "" = $VAULT_ADDR
+	Mounts  []string // PKI mount paths, e.g. pki, pki_int
+	Auth    VaultAuth
+	CACert  string // PEM bundle trusted for the Vault server, "" = system pool
+	Timeout time.Duration
+	Logger  *slog.Logger
+
+	// Built on first use from CACert and Timeout
+	Client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time            // zero = the token does not expire
+	certs   map[string]*CertInfo // by mount and Vault serial, nil when revoked
+}
+
+func NewVaultLoader(address string, mounts []string, auth VaultAuth, logger *slog.Logger) *VaultLoader {
+	return &VaultLoader{
+		Address: address,
+		Mounts:  mounts,
+		Auth:    auth,
+		Timeout: defaultVaultTimeout,
+		Logger:  logger,
+	}
+}
+
+// vaultResponse is the envelope of every Vault answer.
+type vaultResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Auth   *vaultAuthData  `json:"auth"`
+	Errors []string        `json:"errors"`
+}
+
+type vaultAuthData struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"` // seconds
+}
+
+// errVaultNotFound is returned for 404 answers: empty lists, or endpoints
+// missing from older Vault versions.
+var errVaultNotFound = errors.New("not found")
+
+func (l *VaultLoader) LoadCertificates(ctx context.Context) ([]*CertInfo, []*CertError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.init(); err != nil {
+		return nil, []*CertError{NewCertError(l.address(), ErrTypeRead, err)}
+	}
+	if err := l.login(ctx); err != nil {
+		return nil, []*CertError{NewCertError(l.address(), ErrTypeRead, fmt.Errorf("vault login: %w", err))}
+	}
+
+	var certs []*CertInfo
+	var errs []*CertError
+	listed := make(map[string]bool)
+	for _, mount := range l.Mounts {
+		cs, es := l.loadMount(ctx, strings.Trim(mount, "/"), listed)
+		certs = append(certs, cs...)
+		errs = append(errs, es...)
+	}
+
+	// Forget certs tidied away from Vault
+	for key := range l.certs {
+		if !listed[key] {
+			delete(l.certs, key)
+		}
+	}
+	return certs, errs
+}
+
+func (l *VaultLoader) address() string {
+	if l.Address != "" {
+		return strings.TrimSuffix(l.Address, "/")
+	}
+	return strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+}
+
+func (l *VaultLoader) init() error {
+	if l.certs == nil {
+		l.certs = make(map[string]*CertInfo)
+	}
+	if l.Client != nil {
+		return nil
+	}
+	if l.address() == "" {
+		return errors.New("no Vault address: set address or VAULT_ADDR")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if l.CACert != "" {
+		pem, err := os.ReadFile(l.CACert)
+		if err != nil {
+			return fmt.Errorf("read Vault CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in Vault CA %s", l.CACert)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	timeout := l.Timeout
+	if timeout <= 0 {
+		timeout = defaultVaultTimeout
+	}
+	l.Client = &http.Client{Transport: transport, Timeout: timeout}
+	return nil
+}
+
+// login makes sure a valid token is at hand. Tokens obtained through AppRole
+// or Kubernetes auth are renewed by logging in again once their lease is
+// over; static tokens are re-read on every scan.
+func (l *VaultLoader) login(ctx context.Context) error {
+	a := l.Auth
+	method := a.Method
+	if method == "" {
+		method = VaultAuthToken
+	}
+
+	if method == VaultAuthToken {
+		switch {
+		case a.Token != "":
+			l.token = a.Token
+		case a.TokenFile != "":
+			data, err := os.ReadFile(a.TokenFile)
+			if err != nil {
+				return fmt.Errorf("read token: %w", err)
+			}
+			l.token = strings.TrimSpace(string(data))
+		default:
+			l.token = os.Getenv("VAULT_TOKEN")
+		}
+		if l.token == "" {
+			return errors.New("no token: set token, token_file or VAULT_TOKEN")
+		}
+		return nil
+	}
+
+	if l.token != "" && (l.expires.IsZero() || time.Now().Before(l.expires)) {
+		return nil
+	}
+
+	var body map[string]string
+	switch method {
+	case VaultAuthAppRole:
+		secretID := a.SecretID
+		if a.SecretIDFile != "" {
+			data, err := os.ReadFile(a.SecretIDFile)
+			if err != nil {
+				return fmt.Errorf("read secret_id: %w", err)
+			}
+			secretID = strings.TrimSpace(string(data))
+		}
+		body = map[string]string{"role_id": a.RoleID, "secret_id": secretID}
+	case VaultAuthKubernetes:
+		jwtFile := a.JWTFile
+		if jwtFile == "" {
+			jwtFile = filepath.Join(serviceAccountDir, "token")
+		}
+		jwt, err := os.ReadFile(jwtFile)
+		if err != nil {
+			return fmt.Errorf("read service account token: %w", err)
+		}
+		body = map[string]string{"role": a.Role, "jwt": strings.TrimSpace(string(jwt))}
+	default:
+		return fmt.Errorf("unsupported auth method %q", method)
+	}
+
+	mount := a.Mount
+	if mount == "" {
+		mount = method
+	}
+	resp, err := l.do(ctx, http.MethodPost, "auth/"+strings.Trim(mount, "/")+"/login", body, false)
+	if err != nil {
+		return err
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return errors.New("no client token in the login answer")
+	}
+
+	l.token = resp.Auth.ClientToken
+	l.expires = time.Time{}
+	if resp.Auth.LeaseDuration > 0 {
+		// Log in again a little before the lease ends
+		lease := time.Duration(resp.Auth.LeaseDuration) * time.Second
+		l.expires = time.Now().Add(lease - lease/10)
+	}
+	l.Logger.Debug("Logged in to Vault", "method", method, "mount", mount, "lease", resp.Auth.LeaseDuration)
+	return nil
+}
+
+// loadMount returns the issuers of a PKI mount, then every certificate it
+// issued, each certificate once. Listed cache keys are recorded in listed.
+func (l *VaultLoader) loadMount(ctx context.Context, mount string, listed map[string]bool) ([]*CertInfo, []*CertError) {
+	var certs []*CertInfo
+	var errs []*CertError
+	seen := make(map[string]bool)
+	add := func(c *CertInfo) {
+		if c != nil && !seen[c.Fingerprint] {
+			seen[c.Fingerprint] = true
+			certs = append(certs, c)
+		}
+	}
+
+	// Issuers (Vault >= 1.11), or the single CA of older versions
+	ids, err := l.list(ctx, mount+"/issuers")
+	switch {
+	case errors.Is(err, errVaultNotFound):
+		c, err := l.fetch(ctx, mount, "cert/ca")
+		if err != nil && !errors.Is(err, errVaultNotFound) {
+			errs = append(errs, NewCertError(mount+"/cert/ca", ErrTypeRead, err))
+		}
+		add(c)
+	case err != nil:
+		errs = append(errs, NewCertError(mount+"/issuers", ErrTypeRead, err))
+	}
+	for _, id := range ids {
+		c, err := l.fetch(ctx, mount, "issuer/"+id)
+		if err != nil {
+			errs = append(errs, NewCertError(mount+"/issuer/"+id, ErrTypeRead, err))
+			continue
+		}
+		add(c)
+	}
+
+	serials, err := l.list(ctx, mount+"/certs")
+	if err != nil && !errors.Is(err, errVaultNotFound) {
+		return certs, append(errs, NewCertError(mount+"/certs", ErrTypeRead, err))
+	}
+
+	// Cached certs may have been revoked since (Vault >= 1.12 lists them)
+	revoked := make(map[string]bool)
+	list, err := l.list(ctx, mount+"/certs/revoked")
+	if err != nil && !errors.Is(err, errVaultNotFound) {
+		errs = append(errs, NewCertError(mount+"/certs/revoked", ErrTypeRead, err))
+	}
+	for _, serial := range list {
+		revoked[serial] = true
+	}
+
+	for _, serial := range serials {
+		if ctx.Err() != nil {
+			return certs, append(errs, NewCertError(mount+"/certs", ErrTypeUnknown, ctx.Err()))
+		}
+		key := mount + "|" + serial
+		listed[key] = true
+		if revoked[serial] {
+			l.certs[key] = nil
+			continue
+		}
+		c, cached := l.certs[key]
+		if !cached {
+			c, err = l.fetch(ctx, mount, "cert/"+serial)
+			if err != nil {
+				errs = append(errs, NewCertError(mount+"/cert/"+serial, ErrTypeRead, err))
+				continue
+			}
+			l.certs[key] = c
+		}
+		if c != nil {
+			add(c.clone())
+		}
+	}
+	return certs, errs
+}
+
+// fetch reads one certificate endpoint (cert/<serial>, cert/ca, issuer/<id>).
+// Revoked certificates yield nil.
+func (l *VaultLoader) fetch(ctx context.Context, mount, endpoint string) (*CertInfo, error) {
+	resp, err := l.do(ctx, http.MethodGet, mount+"/"+endpoint, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Certificate    string `json:"certificate"`
+		RevocationTime int64  `json:"revocation_time"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, fmt.Errorf("decode answer: %w", err)
+	}
+	if data.RevocationTime > 0 {
+		l.Logger.Debug("Skipping revoked certificate", "mount", mount, "endpoint", endpoint)
+		return nil, nil
+	}
+
+	path := mount + "/" + endpoint
+	cs, es := parseCertificates(path, []byte(data.Certificate), nil, l.Logger)
+	if len(es) > 0 {
+		return nil, es[0].Err
+	}
+	if len(cs) == 0 {
+		return nil, errors.New("no certificate in the answer")
+	}
+	c := cs[0]
+	c.Labels = map[string]string{MountLabel: mount, SerialLabel: c.SerialNumber}
+	return c, nil
+}
+
+// list returns the keys of a LIST endpoint.
+func (l *VaultLoader) list(ctx context.Context, path string) ([]string, error) {
+	resp, err := l.do(ctx, http.MethodGet, path+"?list=true", nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Keys []string `json:"keys"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, fmt.Errorf("decode list: %w", err)
+	}
+	return data.Keys, nil
+}
+
+// do calls the Vault API below /v1/. A rejected token is dropped so that the
+// next scan logs in again.
+func (l *VaultLoader) do(ctx context.Context, method, path string, body any, auth bool) (*vaultResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, l.address()+"/v1/"+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if auth {
+		req.Header.Set("X-Vault-Token", l.token)
+	}
+
+	resp, err := l.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxVaultResponse))
+	if err != nil {
+		return nil, err
+	}
+	var out vaultResponse
+	_ = json.Unmarshal(data, &out)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, errVaultNotFound
+	case resp.StatusCode == http.StatusForbidden && auth && l.Auth.Method != "" && l.Auth.Method != VaultAuthToken:
+		l.token = ""
+		fallthrough
+	case resp.StatusCode != http.StatusOK:
+		if len(out.Errors) > 0 {
+			return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.Join(out.Errors, "; "))
+		}
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return &out, nil
+}
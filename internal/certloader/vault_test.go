@@ -0,0 +1,255 @@
+package certloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault is a Vault stand-in serving one PKI mount and the AppRole and
+// Kubernetes login endpoints.
+type fakeVault struct {
+	t *testing.T
+
+	mu      sync.Mutex
+	issuers map[string][]byte // issuer id -> PEM
+	certs   map[string][]byte // Vault serial -> PEM
+	revoked map[string]bool
+	legacy  bool // Vault < 1.11: no issuers endpoint
+	tokens  map[string]bool
+	fetches int // cert/<serial> reads
+	logins  int
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	v := &fakeVault{
+		t:       t,
+		issuers: make(map[string][]byte),
+		certs:   make(map[string][]byte),
+		revoked: make(map[string]bool),
+		tokens:  map[string]bool{"root": true},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(v.serve))
+	t.Cleanup(srv.Close)
+	return v, srv
+}
+
+func (v *fakeVault) serve(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	reply := func(status int, body map[string]any) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	}
+	data := func(d map[string]any) { reply(http.StatusOK, map[string]any{"data": d}) }
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	if r.Method == http.MethodPost {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		ok := (path == "auth/approle/login" && body["role_id"] == "role" && body["secret_id"] == "secret") ||
+			(path == "auth/k8s/login" && body["role"] == "x509-watch" && body["jwt"] == "pod-jwt")
+		if !ok {
+			reply(http.StatusBadRequest, map[string]any{"errors": []string{"invalid credentials"}})
+			return
+		}
+		v.logins++
+		token := fmt.Sprintf("token-%d", v.logins)
+		v.tokens[token] = true
+		reply(http.StatusOK, map[string]any{"auth": map[string]any{"client_token": token, "lease_duration": 3600}})
+		return
+	}
+
+	if !v.tokens[r.Header.Get("X-Vault-Token")] {
+		reply(http.StatusForbidden, map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+	list := func(m map[string][]byte, filter func(string) bool) {
+		var keys []string
+		for k := range m {
+			if filter == nil || filter(k) {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) == 0 {
+			reply(http.StatusNotFound, map[string]any{"errors": []string{}})
+			return
+		}
+		sort.Strings(keys)
+		data(map[string]any{"keys": keys})
+	}
+
+	switch {
+	case path == "pki/issuers" && !v.legacy:
+		list(v.issuers, nil)
+	case path == "pki/cert/ca" && v.legacy:
+		for _, pem := range v.issuers {
+			data(map[string]any{"certificate": string(pem), "revocation_time": 0})
+			return
+		}
+	case strings.HasPrefix(path, "pki/issuer/") && !v.legacy:
+		data(map[string]any{"certificate": string(v.issuers[strings.TrimPrefix(path, "pki/issuer/")])})
+	case path == "pki/certs":
+		list(v.certs, nil)
+	case path == "pki/certs/revoked" && !v.legacy:
+		list(v.certs, func(k string) bool { return v.revoked[k] })
+	case strings.HasPrefix(path, "pki/cert/"):
+		serial := strings.TrimPrefix(path, "pki/cert/")
+		pem, ok := v.certs[serial]
+		if !ok {
+			reply(http.StatusNotFound, map[string]any{"errors": []string{}})
+			return
+		}
+		v.fetches++
+		revokedAt := 0
+		if v.revoked[serial] {
+			revokedAt = 1700000000
+		}
+		data(map[string]any{"certificate": string(pem), "revocation_time": revokedAt})
+	default:
+		reply(http.StatusNotFound, map[string]any{"errors": []string{}})
+	}
+}
+
+// setup stores a root CA and two leaves, a-serial and b-serial.
+func (v *fakeVault) setup() {
+	now := time.Now()
+	v.issuers["root-id"] = generateTestCert(v.t, "Vault Root", now, now.Add(time.Hour))
+	v.certs["a-serial"] = generateTestCert(v.t, "a.example.com", now, now.Add(time.Hour))
+	v.certs["b-serial"] = generateTestCert(v.t, "b.example.com", now, now.Add(time.Hour))
+}
+
+func vaultNames(certs []*CertInfo) []string {
+	var names []string
+	for _, c := range certs {
+		names = append(names, c.CommonName+"@"+c.Labels[MountLabel])
+		if c.Labels[SerialLabel] != c.SerialNumber {
+			names = append(names, "bad serial label "+c.Labels[SerialLabel])
+		}
+	}
+	return names
+}
+
+func TestVaultLoader_Token(t *testing.T) {
+	v, srv := newFakeVault(t)
+	v.setup()
+
+	l := NewVaultLoader(srv.URL, []string{"pki/"}, VaultAuth{Token: "root"}, slog.Default())
+	certs, errs := l.LoadCertificates(context.Background())
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	want := "[Vault Root@pki a.example.com@pki b.example.com@pki]"
+	if got := fmt.Sprint(vaultNames(certs)); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	if certs[1].FilePath != "pki/cert/a-serial" {
+		t.Errorf("unexpected filepath %s", certs[1].FilePath)
+	}
+
+	// Known serials are not fetched again; revoked ones disappear
+	v.mu.Lock()
+	v.revoked["a-serial"] = true
+	v.certs["c-serial"] = generateTestCert(t, "c.example.com", time.Now(), time.Now().Add(time.Hour))
+	v.mu.Unlock()
+
+	certs, errs = l.LoadCertificates(context.Background())
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	want = "[Vault Root@pki b.example.com@pki c.example.com@pki]"
+	if got := fmt.Sprint(vaultNames(certs)); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if v.fetches != 3 {
+		t.Errorf("expected 3 cert reads (a, b, then c), got %d", v.fetches)
+	}
+}
+
+func TestVaultLoader_AppRoleAndLegacyCA(t *testing.T) {
+	v, srv := newFakeVault(t)
+	v.setup()
+	v.legacy = true
+	v.revoked["b-serial"] = true // only seen through revocation_time
+
+	secretFile := writeFile(t, t.TempDir(), "secret-id", []byte("secret\n"))
+	auth := VaultAuth{Method: VaultAuthAppRole, RoleID: "role", SecretIDFile: secretFile}
+	l := NewVaultLoader(srv.URL, []string{"pki"}, auth, slog.Default())
+
+	for i := 0; i < 2; i++ {
+		certs, errs := l.LoadCertificates(context.Background())
+		if len(errs) != 0 {
+			t.Fatalf("scan %d: unexpected errors: %v", i, errs)
+		}
+		want := "[Vault Root@pki a.example.com@pki]"
+		if got := fmt.Sprint(vaultNames(certs)); got != want {
+			t.Fatalf("scan %d: expected %s, got %s", i, want, got)
+		}
+	}
+	if v.logins != 1 {
+		t.Errorf("expected the token to be reused, got %d logins", v.logins)
+	}
+
+	// A revoked token leads to a new login on the next scan
+	v.mu.Lock()
+	v.tokens = map[string]bool{}
+	v.mu.Unlock()
+	if _, errs := l.LoadCertificates(context.Background()); len(errs) == 0 {
+		t.Fatal("expected permission denied errors")
+	}
+	if _, errs := l.LoadCertificates(context.Background()); len(errs) != 0 || v.logins != 2 {
+		t.Fatalf("expected a second login, got %d logins and %v", v.logins, errs)
+	}
+}
+
+func TestVaultLoader_Kubernetes(t *testing.T) {
+	v, srv := newFakeVault(t)
+	v.setup()
+
+	saDir := t.TempDir()
+	writeFile(t, saDir, "token", []byte("pod-jwt"))
+	orig := serviceAccountDir
+	serviceAccountDir = saDir
+	t.Cleanup(func() { serviceAccountDir = orig })
+
+	auth := VaultAuth{Method: VaultAuthKubernetes, Mount: "k8s", Role: "x509-watch"}
+	certs, errs := NewVaultLoader(srv.URL, []string{"pki"}, auth, slog.Default()).LoadCertificates(context.Background())
+	if len(errs) != 0 || len(certs) != 3 {
+		t.Fatalf("expected 3 certs, got %v and %v", vaultNames(certs), errs)
+	}
+}
+
+func TestVaultLoader_Errors(t *testing.T) {
+	_, srv := newFakeVault(t)
+
+	tests := map[string]struct {
+		auth VaultAuth
+		want string
+	}{
+		"bad approle": {VaultAuth{Method: VaultAuthAppRole, RoleID: "role", SecretID: "nope"}, "invalid credentials"},
+		"no token":    {VaultAuth{}, "no token"},
+		"bad token":   {VaultAuth{Token: "nope"}, "permission denied"},
+	}
+	t.Setenv("VAULT_TOKEN", "")
+	for name, tc := range tests {
+		_, errs := NewVaultLoader(srv.URL, []string{"pki"}, tc.auth, slog.Default()).LoadCertificates(context.Background())
+		if len(errs) == 0 || errs[0].Type != ErrTypeRead || !strings.Contains(errs[0].Error(), tc.want) {
+			t.Errorf("%s: expected a read_error containing %q, got %v", name, tc.want, errs)
+		}
+	}
+
+	// An empty mount is not an error
+	certs, errs := NewVaultLoader(srv.URL, []string{"pki"}, VaultAuth{Token: "root"}, slog.Default()).LoadCertificates(context.Background())
+	if len(certs) != 0 || len(errs) != 0 {
+		t.Errorf("expected nothing from an empty mount, got %v and %v", certs, errs)
+	}
+}
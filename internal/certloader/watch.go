@@ -0,0 +1,64 @@
+package certloader
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const DefaultWatchDebounce = 500 * time.Millisecond
+
+// OnChange receives the full, up to date result of a loader after a rescan
+// triggered by filesystem events.
+type OnChange func(certs []*CertInfo, errs []*CertError)
+
+// watchEvents runs the fsnotify loop until ctx is done. handle is called for
+// every event and reports whether it matters; once no relevant event arrived
+// for debounce, flush gets the sorted set of touched paths.
+func watchEvents(ctx context.Context, w *fsnotify.Watcher, debounce time.Duration, logger *slog.Logger,
+	handle func(ev fsnotify.Event) bool, flush func(paths []string)) error {
+	if debounce <= 0 {
+		debounce = DefaultWatchDebounce
+	}
+
+	pending := make(map[string]struct{})
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			// Permission/ownership changes do not alter the content
+			if ev.Op == fsnotify.Chmod || !handle(ev) {
+				continue
+			}
+			pending[ev.Name] = struct{}{}
+			timer.Reset(debounce)
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Warn("Filesystem watch error", "error", err)
+
+		case <-timer.C:
+			paths := make([]string, 0, len(pending))
+			for p := range pending {
+				paths = append(paths, p)
+			}
+			sort.Strings(paths)
+			pending = make(map[string]struct{})
+			flush(paths)
+		}
+	}
+}
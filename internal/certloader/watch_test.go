@@ -0,0 +1,43 @@
+package certloader
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestWatchEvents_DebouncesBursts(t *testing.T) {
+	w := &fsnotify.Watcher{Events: make(chan fsnotify.Event), Errors: make(chan error)}
+	flushed := make(chan []string, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchEvents(ctx, w, 50*time.Millisecond, slog.Default(),
+		func(ev fsnotify.Event) bool { return ev.Name != "/ignored" },
+		func(paths []string) { flushed <- paths })
+
+	w.Events <- fsnotify.Event{Name: "/b.pem", Op: fsnotify.Write}
+	w.Events <- fsnotify.Event{Name: "/a.pem", Op: fsnotify.Create}
+	w.Events <- fsnotify.Event{Name: "/b.pem", Op: fsnotify.Write}
+	w.Events <- fsnotify.Event{Name: "/c.pem", Op: fsnotify.Chmod}
+	w.Events <- fsnotify.Event{Name: "/ignored", Op: fsnotify.Write}
+
+	select {
+	case paths := <-flushed:
+		if want := []string{"/a.pem", "/b.pem"}; !reflect.DeepEqual(paths, want) {
+			t.Fatalf("expected %v, got %v", want, paths)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for flush")
+	}
+
+	select {
+	case paths := <-flushed:
+		t.Fatalf("expected a single flush, got another one: %v", paths)
+	case <-time.After(150 * time.Millisecond):
+	}
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// certBaseLabels are carried by every per-certificate series, crlBaseLabels
+// by every per-CRL one. The serial tells apart certificates of one file
+// sharing a common name and issuer (e.g. a renewal appended to a bundle).
+var (
+	certBaseLabels = []string{"common_name", "issuer", "filepath", "serial"}
+	crlBaseLabels  = []string{"issuer", "filepath"}
+)
+
+// certVec is a per-certificate gauge whose label names are certBaseLabels, its
+// own fixed labels, plus extra labels chosen on every publish (CertInfo.Labels
+// keys). The inner GaugeVec is rebuilt on reset, so label names may change
+// between scans.
+//
+// Describe sends nothing, which makes it an "unchecked" collector for the registry.
+type certVec struct {
+	opts   prometheus.GaugeOpts
+	base   []string
+	labels []string
+
+	mu  sync.RWMutex
+	vec *prometheus.GaugeVec
+}
+
+func newCertVec(opts prometheus.GaugeOpts, labels ...string) *certVec {
+	v := &certVec{opts: opts, base: certBaseLabels, labels: labels}
+	v.reset(nil)
+	return v
+}
+
+// newCRLVec is a certVec keyed by crlBaseLabels.
+func newCRLVec(opts prometheus.GaugeOpts) *certVec {
+	v := &certVec{opts: opts, base: crlBaseLabels}
+	v.reset(nil)
+	return v
+}
+
+// reset drops every series and sets the extra label names for the next publish.
+// Extra labels the vec already carries (e.g. a loader's serial on x509_cert_info)
+// are skipped: the vec's own value wins.
+func (v *certVec) reset(extraLabels []string) {
+	names := append(append([]string{}, v.base...), v.labels...)
+	for _, name := range extraLabels {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	vec := prometheus.NewGaugeVec(v.opts, names)
+
+	v.mu.Lock()
+	v.vec = vec
+	v.mu.Unlock()
+}
+
+func (v *certVec) With(labels prometheus.Labels) prometheus.Gauge {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.vec.With(labels)
+}
+
+func (v *certVec) Describe(chan<- *prometheus.Desc) {}
+
+func (v *certVec) Collect(ch chan<- prometheus.Metric) {
+	v.mu.RLock()
+	vec := v.vec
+	v.mu.RUnlock()
+	vec.Collect(ch)
+}
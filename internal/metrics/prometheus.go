@@ -1,84 +1,290 @@
 package metrics
 
 import (
+	"maps"
 	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 
 	"x509-watch/internal/certloader"
+	"x509-watch/internal/rules"
 )
 
-var (
-	validCerts = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "x509_valid_certs_total",
-			Help: "Number of current valid (non-expired) certificates",
-		},
-	)
-	certNotBefore = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "x509_cert_not_before",
-			Help: "Certificate validity start time (unix seconds)",
-		},
-		[]string{"common_name", "issuer", "filepath"},
-	)
+// collectors holds one full set of certificate metrics, so that a publisher
+// can write either to the global registry or to a private one (e.g. /probe).
+type collectors struct {
+	validCerts           prometheus.Gauge
+	certNotBefore        *certVec
+	certNotAfter         *certVec
+	certExpired          *certVec
+	certExpiresInSeconds *certVec
+	certValidityState    *certVec
+	certLifetimeSeconds  *certVec
+	certLifetimeConsumed *certVec
+	certInfo             *certVec
+	certChainValid       *certVec
+	certRevoked          *certVec
+	certRevocationErrors *certVec
+	certKeyMatch         *certVec
+	certPolicyViolation  *certVec
+	certRuleFailed       *certVec
+	certsByExpiryBucket  *prometheus.GaugeVec
+	certErrorsByType     *prometheus.GaugeVec
 
-	certNotAfter = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "x509_cert_not_after",
-			Help: "Certificate expiry time (unix seconds)",
-		},
-		[]string{"common_name", "issuer", "filepath"},
-	)
+	ruleCheckedCerts *prometheus.GaugeVec
+	ruleFailedCerts  *prometheus.GaugeVec
+	ruleErrors       *prometheus.GaugeVec
 
-	certExpired = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "x509_cert_expired",
-			Help: "1 if certificate is expired, 0 otherwise",
-		},
-		[]string{"common_name", "issuer", "filepath"},
-	)
+	crlThisUpdate     *certVec
+	crlNextUpdate     *certVec
+	crlRevokedEntries *certVec
+}
 
-	certExpiresInSeconds = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "x509_cert_expires_in_seconds",
-			Help: "Seconds until certificate expiry (negative if expired)",
-		},
-		[]string{"common_name", "issuer", "filepath"},
-	)
+func newCollectors() *collectors {
+	return &collectors{
+		validCerts: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "x509_valid_certs_total",
+				Help: "Number of certificates within their validity period (neither expired nor not yet valid)",
+			},
+		),
+		certNotBefore: newCertVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_not_before",
+				Help: "Certificate validity start time (unix seconds)",
+			},
+		),
+		certNotAfter: newCertVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_not_after",
+				Help: "Certificate expiry time (unix seconds)",
+			},
+		),
+		certExpired: newCertVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_expired",
+				Help: "1 if certificate is expired, 0 otherwise",
+			},
+		),
+		certExpiresInSeconds: newCertVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_expires_in_seconds",
+				Help: "Seconds until certificate expiry (negative if expired)",
+			},
+		),
+		certValidityState: newCertVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_validity_state",
+				Help: "1 for the current validity state of the certificate (not_yet_valid, valid, expired), 0 for the others",
+			},
+			"state",
+		),
+		certLifetimeSeconds: newCertVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_lifetime_seconds",
+				Help: "Length of the certificate validity period (seconds)",
+			},
+		),
+		certLifetimeConsumed: newCertVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_lifetime_consumed_ratio",
+				Help: "Fraction of the certificate validity period elapsed, from 0 at not_before to 1 at not_after",
+			},
+		),
+		certInfo: newCertVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_info",
+				Help: "Always 1, carries the certificate metadata as labels",
+			},
+			CertInfoLabels...,
+		),
+		certChainValid: newCertVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_chain_valid",
+				Help: "1 if the bundle of this leaf chains to a trusted root, 0 otherwise (see reason)",
+			},
+			"reason",
+		),
+		certRevoked: newCertVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_revoked",
+				Help: "1 if the certificate is revoked according to OCSP or its CRL, 0 otherwise",
+			},
+			"method",
+		),
+		certRevocationErrors: newCertVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_revocation_check_errors",
+				Help: "Number of OCSP responders or CRL distribution points that failed in the last check",
+			},
+			"method",
+		),
+		certKeyMatch: newCertVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_key_match",
+				Help: "1 if a private key of the source matches the certificate, 0 otherwise (see reason)",
+			},
+			"key_file", "reason",
+		),
+		certPolicyViolation: newCertVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_policy_violation",
+				Help: "1 for every policy rule the certificate breaks (weak signature, key size, validity period)",
+			},
+			"rule",
+		),
+		certRuleFailed: newCertVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_rule_failed",
+				Help: "1 for every user-defined rule the certificate fails",
+			},
+			"rule",
+		),
+		certsByExpiryBucket: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "x509_certs_by_expiry_bucket",
+				Help: "Number of certificates grouped by expiry time range",
+			},
+			[]string{"range"},
+		),
+		certErrorsByType: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "x509_cert_errors_total",
+				Help: "Number of certificates load errors by type in the last scan",
+			},
+			[]string{"error_type"}, // read, parse, pem, unknown
+		),
+		ruleCheckedCerts: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "x509_rule_checked_certs",
+				Help: "Number of certificates a user-defined rule applied to in the last evaluation",
+			},
+			[]string{"rule"},
+		),
+		ruleFailedCerts: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "x509_rule_failed_certs",
+				Help: "Number of certificates failing a user-defined rule in the last evaluation",
+			},
+			[]string{"rule"},
+		),
+		ruleErrors: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "x509_rule_evaluation_errors",
+				Help: "Number of certificates a user-defined rule could not be evaluated on in the last evaluation",
+			},
+			[]string{"rule"},
+		),
+		crlThisUpdate: newCRLVec(
+			prometheus.GaugeOpts{
+				Name: "x509_crl_this_update",
+				Help: "CRL issue time (unix seconds)",
+			},
+		),
+		crlNextUpdate: newCRLVec(
+			prometheus.GaugeOpts{
+				Name: "x509_crl_next_update",
+				Help: "Time by which the next CRL is due (unix seconds), clients reject the CRL after it",
+			},
+		),
+		crlRevokedEntries: newCRLVec(
+			prometheus.GaugeOpts{
+				Name: "x509_crl_revoked_entries",
+				Help: "Number of revoked certificates listed in the CRL",
+			},
+		),
+	}
+}
+
+func (c *collectors) list() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.validCerts,
+		c.certNotBefore,
+		c.certNotAfter,
+		c.certExpired,
+		c.certExpiresInSeconds,
+		c.certValidityState,
+		c.certLifetimeSeconds,
+		c.certLifetimeConsumed,
+		c.certInfo,
+		c.certChainValid,
+		c.certRevoked,
+		c.certRevocationErrors,
+		c.certKeyMatch,
+		c.certPolicyViolation,
+		c.certRuleFailed,
+		c.certsByExpiryBucket,
+		c.certErrorsByType,
+		c.ruleCheckedCerts,
+		c.ruleFailedCerts,
+		c.ruleErrors,
+		c.crlThisUpdate,
+		c.crlNextUpdate,
+		c.crlRevokedEntries,
+	}
+}
 
-	certsByExpiryBucket = prometheus.NewGaugeVec(
+// defaultCollectors are registered on the global registry and served on /metrics.
+var defaultCollectors = newCollectors()
+
+var (
+	validCerts           = defaultCollectors.validCerts
+	certNotBefore        = defaultCollectors.certNotBefore
+	certNotAfter         = defaultCollectors.certNotAfter
+	certExpired          = defaultCollectors.certExpired
+	certExpiresInSeconds = defaultCollectors.certExpiresInSeconds
+	certValidityState    = defaultCollectors.certValidityState
+	certLifetimeSeconds  = defaultCollectors.certLifetimeSeconds
+	certLifetimeConsumed = defaultCollectors.certLifetimeConsumed
+	certInfo             = defaultCollectors.certInfo
+	certChainValid       = defaultCollectors.certChainValid
+	certRevoked          = defaultCollectors.certRevoked
+	certRevocationErrors = defaultCollectors.certRevocationErrors
+	certKeyMatch         = defaultCollectors.certKeyMatch
+	certPolicyViolation  = defaultCollectors.certPolicyViolation
+	certRuleFailed       = defaultCollectors.certRuleFailed
+	certsByExpiryBucket  = defaultCollectors.certsByExpiryBucket
+	certErrorsByType     = defaultCollectors.certErrorsByType
+	crlThisUpdate        = defaultCollectors.crlThisUpdate
+	crlNextUpdate        = defaultCollectors.crlNextUpdate
+	crlRevokedEntries    = defaultCollectors.crlRevokedEntries
+
+	buildInfo = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "x509_certs_by_expiry_bucket",
-			Help: "Number of certificates grouped by expiry time range",
+			Name: "x509_exporter_build_info",
+			Help: "Build info for the x509 exporter",
 		},
-		[]string{"range"},
+		[]string{"version", "revision", "goversion"},
 	)
 
-	certErrorsByType = prometheus.NewGaugeVec(
+	configLastReloadSuccessful = prometheus.NewGauge(
 		prometheus.GaugeOpts{
-			Name: "x509_cert_errors_total",
-			Help: "Number of certificates load errors by type in the last scan",
+			Name: "x509_config_last_reload_successful",
+			Help: "1 if the last configuration reload succeeded, 0 otherwise",
 		},
-		[]string{"error_type"}, // read, parse, pem, unknown
 	)
 
-	buildInfo = prometheus.NewGaugeVec(
+	configLastReloadSuccessTimestamp = prometheus.NewGauge(
 		prometheus.GaugeOpts{
-			Name: "x509_exporter_build_info",
-			Help: "Build info for the x509 exporter",
+			Name: "x509_config_last_reload_success_timestamp_seconds",
+			Help: "Timestamp of the last successful configuration reload (unix seconds)",
 		},
-		[]string{"version", "revision", "goversion"},
 	)
 )
 
 // expiryBuckets defines the ranges for certificate expiry bucketing.
-// Ordered from most urgent to least. A cert falls into the first matching bucket.
+// Ordered from most urgent to least. A cert falls into the first matching bucket,
+// not_yet_valid ones excepted.
 var expiryBuckets = []struct {
 	Label     string
 	Threshold time.Duration
 }{
+	{"not_yet_valid", 0},
 	{"expired", 0},
 	{"<1d", 24 * time.Hour},
 	{"<7d", 7 * 24 * time.Hour},
@@ -88,29 +294,38 @@ var expiryBuckets = []struct {
 }
 
 func init() {
-	prometheus.MustRegister(
-		validCerts,
-		certNotBefore,
-		certNotAfter,
-		certExpired,
-		certExpiresInSeconds,
-		certsByExpiryBucket,
-		certErrorsByType,
-		buildInfo,
-	)
+	prometheus.MustRegister(defaultCollectors.list()...)
+	prometheus.MustRegister(buildInfo, configLastReloadSuccessful, configLastReloadSuccessTimestamp)
 }
 
 // PromPublisher publishes certificate metrics to Prometheus.
 type PromPublisher struct {
 	Clock          func() time.Time
 	PerCertMetrics bool // when false, only aggregate/bucket metrics are published
+
+	m *collectors
 }
 
+// NewPromPublisher returns a publisher writing to the global registry.
 func NewPromPublisher(clock func() time.Time) *PromPublisher {
 	if clock == nil {
 		clock = time.Now
 	}
-	return &PromPublisher{Clock: clock, PerCertMetrics: true}
+	return &PromPublisher{Clock: clock, PerCertMetrics: true, m: defaultCollectors}
+}
+
+// NewRegistryPublisher returns a publisher with its own set of metrics,
+// registered on reg instead of the global registry.
+func NewRegistryPublisher(reg prometheus.Registerer, clock func() time.Time) (*PromPublisher, error) {
+	m := newCollectors()
+	for _, c := range m.list() {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	p := NewPromPublisher(clock)
+	p.m = m
+	return p, nil
 }
 
 func boolToFloat(b bool) float64 {
@@ -122,13 +337,26 @@ func boolToFloat(b bool) float64 {
 
 func (p *PromPublisher) PublishCerts(certs []*certloader.CertInfo, errs []*certloader.CertError) {
 
+	m := p.m
+	extraLabels := extraLabelNames(certs)
+
 	// Reset all metrics before republishing
-	certNotBefore.Reset()
-	certNotAfter.Reset()
-	certExpired.Reset()
-	certExpiresInSeconds.Reset()
-	certsByExpiryBucket.Reset()
-	certErrorsByType.Reset()
+	m.certNotBefore.reset(extraLabels)
+	m.certNotAfter.reset(extraLabels)
+	m.certExpired.reset(extraLabels)
+	m.certExpiresInSeconds.reset(extraLabels)
+	m.certValidityState.reset(extraLabels)
+	m.certLifetimeSeconds.reset(extraLabels)
+	m.certLifetimeConsumed.reset(extraLabels)
+	m.certInfo.reset(extraLabels)
+	m.certChainValid.reset(extraLabels)
+	m.certRevoked.reset(extraLabels)
+	m.certRevocationErrors.reset(extraLabels)
+	m.certKeyMatch.reset(extraLabels)
+	m.certPolicyViolation.reset(extraLabels)
+	m.certRuleFailed.reset(extraLabels)
+	m.certsByExpiryBucket.Reset()
+	m.certErrorsByType.Reset()
 
 	now := p.Clock()
 
@@ -138,35 +366,106 @@ func (p *PromPublisher) PublishCerts(certs []*certloader.CertInfo, errs []*certl
 		bucketCounts[b.Label] = 0
 	}
 
+	// The aggregates count a certificate once per file, whatever the number
+	// of times a loader emits it (e.g. a kubeconfig CA used by several
+	// contexts, once per context).
+	counted := make(map[[2]string]bool, len(certs))
 	for _, c := range certs {
 		expiresIn := c.ExpiresInSeconds(now)
 		expired := c.IsExpired(now)
+		state := c.ValidityState(now)
 
 		if p.PerCertMetrics {
 			labels := prometheus.Labels{
 				"common_name": c.CommonName,
 				"issuer":      c.Issuer,
 				"filepath":    c.FilePath,
+				"serial":      c.SerialNumber,
+			}
+			for _, name := range extraLabels {
+				labels[name] = c.Labels[name]
+			}
+			m.certNotBefore.With(labels).Set(float64(c.NotBefore.Unix()))
+			m.certNotAfter.With(labels).Set(float64(c.NotAfter.Unix()))
+			m.certExpired.With(labels).Set(boolToFloat(expired))
+			m.certExpiresInSeconds.With(labels).Set(expiresIn)
+			for _, s := range certloader.ValidityStates() {
+				stateLabels := maps.Clone(labels)
+				stateLabels["state"] = string(s)
+				m.certValidityState.With(stateLabels).Set(boolToFloat(s == state))
+			}
+			m.certLifetimeSeconds.With(labels).Set(c.LifetimeSeconds())
+			if ratio, ok := c.LifetimeConsumedRatio(now); ok {
+				m.certLifetimeConsumed.With(labels).Set(ratio)
 			}
-			certNotBefore.With(labels).Set(float64(c.NotBefore.Unix()))
-			certNotAfter.With(labels).Set(float64(c.NotAfter.Unix()))
-			certExpired.With(labels).Set(boolToFloat(expired))
-			certExpiresInSeconds.With(labels).Set(expiresIn)
+
+			if c.Chain != nil {
+				chainLabels := maps.Clone(labels)
+				chainLabels["reason"] = string(c.Chain.Reason)
+				m.certChainValid.With(chainLabels).Set(boolToFloat(c.Chain.Valid))
+			}
+			if r := c.Revocation; r != nil {
+				if r.Checked {
+					revLabels := maps.Clone(labels)
+					revLabels["method"] = r.Method
+					m.certRevoked.With(revLabels).Set(boolToFloat(r.Revoked))
+				}
+				for method, count := range r.Errors {
+					errLabels := maps.Clone(labels)
+					errLabels["method"] = method
+					m.certRevocationErrors.With(errLabels).Set(float64(count))
+				}
+			}
+			if c.Key != nil {
+				keyLabels := maps.Clone(labels)
+				keyLabels["key_file"] = c.Key.KeyPath
+				keyLabels["reason"] = string(c.Key.Reason)
+				m.certKeyMatch.With(keyLabels).Set(boolToFloat(c.Key.Match))
+			}
+			for _, rule := range c.Violations {
+				ruleLabels := maps.Clone(labels)
+				ruleLabels["rule"] = rule
+				m.certPolicyViolation.With(ruleLabels).Set(1)
+			}
+			for _, rule := range c.FailedRules {
+				ruleLabels := maps.Clone(labels)
+				ruleLabels["rule"] = rule
+				m.certRuleFailed.With(ruleLabels).Set(1)
+			}
+
+			for name, value := range certInfoLabels(c) {
+				labels[name] = value
+			}
+			m.certInfo.With(labels).Set(1)
+		}
+
+		if c.Fingerprint != "" {
+			key := [2]string{c.FilePath, c.Fingerprint}
+			if counted[key] {
+				continue
+			}
+			counted[key] = true
 		}
 
-		if !expired {
+		if state == certloader.StateValid {
 			validCount++
 		}
 
-		// Classify into expiry bucket
-		remaining := time.Duration(expiresIn) * time.Second
-		bucketCounts[classifyExpiryBucket(remaining)]++
+		// Classify into expiry bucket, certificates not valid yet apart
+		switch state {
+		case certloader.StateNotYetValid:
+			bucketCounts[string(certloader.StateNotYetValid)]++
+		case certloader.StateExpired:
+			bucketCounts["expired"]++
+		default:
+			bucketCounts[classifyExpiryBucket(c.NotAfter.Sub(now))]++
+		}
 	}
 
-	validCerts.Set(float64(validCount))
+	m.validCerts.Set(float64(validCount))
 
 	for label, count := range bucketCounts {
-		certsByExpiryBucket.WithLabelValues(label).Set(float64(count))
+		m.certsByExpiryBucket.WithLabelValues(label).Set(float64(count))
 	}
 
 	errorsByType := make(map[certloader.CertErrorType]int)
@@ -175,16 +474,116 @@ func (p *PromPublisher) PublishCerts(certs []*certloader.CertInfo, errs []*certl
 	}
 
 	for errType, count := range errorsByType {
-		certErrorsByType.WithLabelValues(string(errType)).Set(float64(count))
+		m.certErrorsByType.WithLabelValues(string(errType)).Set(float64(count))
 	}
 }
 
+// PublishCRLs replaces the per-CRL metrics with crls.
+func (p *PromPublisher) PublishCRLs(crls []*certloader.CRLInfo) {
+	m := p.m
+	sets := make([]map[string]string, 0, len(crls))
+	for _, c := range crls {
+		sets = append(sets, c.Labels)
+	}
+	extraLabels := labelNames(sets)
+
+	m.crlThisUpdate.reset(extraLabels)
+	m.crlNextUpdate.reset(extraLabels)
+	m.crlRevokedEntries.reset(extraLabels)
+
+	for _, c := range crls {
+		labels := prometheus.Labels{
+			"issuer":   c.Issuer,
+			"filepath": c.FilePath,
+		}
+		for _, name := range extraLabels {
+			labels[name] = c.Labels[name]
+		}
+		m.crlThisUpdate.With(labels).Set(float64(c.ThisUpdate.Unix()))
+		if !c.NextUpdate.IsZero() {
+			m.crlNextUpdate.With(labels).Set(float64(c.NextUpdate.Unix()))
+		}
+		m.crlRevokedEntries.With(labels).Set(float64(c.RevokedCount))
+	}
+}
+
+// PublishRules replaces the per-rule metrics with the results of the last
+// rule evaluation. Per-certificate failures are published by PublishCerts.
+func (p *PromPublisher) PublishRules(results []rules.Result) {
+	m := p.m
+	m.ruleCheckedCerts.Reset()
+	m.ruleFailedCerts.Reset()
+	m.ruleErrors.Reset()
+
+	for _, r := range results {
+		m.ruleCheckedCerts.WithLabelValues(r.Rule).Set(float64(r.Checked))
+		m.ruleFailedCerts.WithLabelValues(r.Rule).Set(float64(r.Failed))
+		m.ruleErrors.WithLabelValues(r.Rule).Set(float64(r.Errors))
+	}
+}
+
+// CertInfoLabels are the labels only carried by x509_cert_info.
+var CertInfoLabels = []string{
+	"fingerprint_sha256", "sans",
+	"key_algorithm", "key_size", "signature_algorithm",
+	"is_ca", "key_usage", "ext_key_usage",
+}
+
+// certInfoLabels returns the values of CertInfoLabels for c. Lists are
+// comma-separated.
+func certInfoLabels(c *certloader.CertInfo) prometheus.Labels {
+	keySize := ""
+	if c.KeySize > 0 {
+		keySize = strconv.Itoa(c.KeySize)
+	}
+	return prometheus.Labels{
+		"fingerprint_sha256":  c.Fingerprint,
+		"sans":                strings.Join(c.SANs, ","),
+		"key_algorithm":       c.KeyAlgorithm,
+		"key_size":            keySize,
+		"signature_algorithm": c.SignatureAlgorithm,
+		"is_ca":               strconv.FormatBool(c.IsCA),
+		"key_usage":           strings.Join(c.KeyUsages, ","),
+		"ext_key_usage":       strings.Join(c.ExtKeyUsages, ","),
+	}
+}
+
+// extraLabelNames returns the sorted union of CertInfo.Labels keys. Certs missing
+// one of them get an empty value, which Prometheus treats as an absent label.
+// Keys named like a certBaseLabels one (e.g. a loader's serial) are left out:
+// the base value wins.
+func extraLabelNames(certs []*certloader.CertInfo) []string {
+	sets := make([]map[string]string, 0, len(certs))
+	for _, c := range certs {
+		sets = append(sets, c.Labels)
+	}
+	return slices.DeleteFunc(labelNames(sets), func(name string) bool {
+		return slices.Contains(certBaseLabels, name)
+	})
+}
+
+// labelNames returns the sorted union of the keys of sets.
+func labelNames(sets []map[string]string) []string {
+	seen := make(map[string]bool)
+	for _, labels := range sets {
+		for name := range labels {
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func classifyExpiryBucket(remaining time.Duration) string {
 	if remaining <= 0 {
 		return "expired"
 	}
 	for _, b := range expiryBuckets {
-		if b.Label == "expired" || b.Label == ">=90d" {
+		if b.Threshold == 0 {
 			continue
 		}
 		if remaining < b.Threshold {
@@ -201,3 +600,11 @@ func SetBuildInfo(version, revision string) {
 		"goversion": runtime.Version(),
 	}).Set(1.0)
 }
+
+// SetConfigReload records the outcome of a configuration (re)load.
+func SetConfigReload(ok bool, at time.Time) {
+	configLastReloadSuccessful.Set(boolToFloat(ok))
+	if ok {
+		configLastReloadSuccessTimestamp.Set(float64(at.Unix()))
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	"x509-watch/internal/certloader"
+	"x509-watch/internal/rules"
 )
 
 func fixedClock(t time.Time) func() time.Time {
@@ -209,6 +211,51 @@ func TestPublishCerts_ExpiryBuckets(t *testing.T) {
 	}
 }
 
+func TestPublishCerts_NotYetValid(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	pub, err := NewRegistryPublisher(reg, fixedClock(now))
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+
+	pub.PublishCerts([]*certloader.CertInfo{
+		{FilePath: "/future.pem", CommonName: "future", Issuer: "CA", NotBefore: now.Add(time.Hour), NotAfter: now.Add(120 * 24 * time.Hour)},
+		{FilePath: "/valid.pem", CommonName: "valid", Issuer: "CA", NotBefore: now.Add(-time.Hour), NotAfter: now.Add(120 * 24 * time.Hour)},
+		{FilePath: "/old.pem", CommonName: "old", Issuer: "CA", NotBefore: now.Add(-2 * time.Hour), NotAfter: now.Add(-time.Hour)},
+	}, nil)
+
+	expected := `
+		# HELP x509_cert_validity_state 1 for the current validity state of the certificate (not_yet_valid, valid, expired), 0 for the others
+		# TYPE x509_cert_validity_state gauge
+		x509_cert_validity_state{common_name="future",filepath="/future.pem",issuer="CA",serial="",state="expired"} 0
+		x509_cert_validity_state{common_name="future",filepath="/future.pem",issuer="CA",serial="",state="not_yet_valid"} 1
+		x509_cert_validity_state{common_name="future",filepath="/future.pem",issuer="CA",serial="",state="valid"} 0
+		x509_cert_validity_state{common_name="old",filepath="/old.pem",issuer="CA",serial="",state="expired"} 1
+		x509_cert_validity_state{common_name="old",filepath="/old.pem",issuer="CA",serial="",state="not_yet_valid"} 0
+		x509_cert_validity_state{common_name="old",filepath="/old.pem",issuer="CA",serial="",state="valid"} 0
+		x509_cert_validity_state{common_name="valid",filepath="/valid.pem",issuer="CA",serial="",state="expired"} 0
+		x509_cert_validity_state{common_name="valid",filepath="/valid.pem",issuer="CA",serial="",state="not_yet_valid"} 0
+		x509_cert_validity_state{common_name="valid",filepath="/valid.pem",issuer="CA",serial="",state="valid"} 1
+		# HELP x509_certs_by_expiry_bucket Number of certificates grouped by expiry time range
+		# TYPE x509_certs_by_expiry_bucket gauge
+		x509_certs_by_expiry_bucket{range="<1d"} 0
+		x509_certs_by_expiry_bucket{range="<30d"} 0
+		x509_certs_by_expiry_bucket{range="<7d"} 0
+		x509_certs_by_expiry_bucket{range="<90d"} 0
+		x509_certs_by_expiry_bucket{range=">=90d"} 1
+		x509_certs_by_expiry_bucket{range="expired"} 1
+		x509_certs_by_expiry_bucket{range="not_yet_valid"} 1
+		# HELP x509_valid_certs_total Number of certificates within their validity period (neither expired nor not yet valid)
+		# TYPE x509_valid_certs_total gauge
+		x509_valid_certs_total 1
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"x509_cert_validity_state", "x509_certs_by_expiry_bucket", "x509_valid_certs_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestPublishCerts_PerCertMetricsDisabled(t *testing.T) {
 	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
 	pub := NewPromPublisher(fixedClock(now))
@@ -261,3 +308,488 @@ func TestClassifyExpiryBucket(t *testing.T) {
 		}
 	}
 }
+
+func TestNewRegistryPublisher_IsolatedFromGlobal(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// Global publisher: 1 cert
+	NewPromPublisher(fixedClock(now)).PublishCerts([]*certloader.CertInfo{
+		{FilePath: "/global.pem", CommonName: "global", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour)},
+	}, nil)
+
+	reg := prometheus.NewRegistry()
+	pub, err := NewRegistryPublisher(reg, fixedClock(now))
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+	pub.PublishCerts([]*certloader.CertInfo{
+		{FilePath: "/a.pem", CommonName: "a", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour)},
+		{FilePath: "/b.pem", CommonName: "b", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour)},
+	}, nil)
+
+	if got := testutil.ToFloat64(pub.m.validCerts); got != 2 {
+		t.Fatalf("expected private validCerts=2, got %f", got)
+	}
+	if got := testutil.ToFloat64(validCerts); got != 1 {
+		t.Fatalf("expected global validCerts=1 (untouched), got %f", got)
+	}
+	if count, err := testutil.GatherAndCount(reg, "x509_cert_not_after"); err != nil || count != 2 {
+		t.Fatalf("expected 2 x509_cert_not_after series in private registry, got %d (err=%v)", count, err)
+	}
+
+	// A second publisher on the same registry must fail to register
+	if _, err := NewRegistryPublisher(reg, fixedClock(now)); err == nil {
+		t.Fatal("expected duplicate registration error")
+	}
+}
+
+func TestPublishCerts_ExtraLabels(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	pub, err := NewRegistryPublisher(reg, fixedClock(now))
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+
+	certs := []*certloader.CertInfo{
+		{FilePath: "/a.pem", CommonName: "a", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+			Labels: map[string]string{"source": "vault", "team": "infra"}},
+		{FilePath: "b.example.com:443", CommonName: "b", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+			Labels: map[string]string{"source": "ingress"}},
+	}
+	pub.PublishCerts(certs, nil)
+
+	expected := `
+		# HELP x509_cert_expired 1 if certificate is expired, 0 otherwise
+		# TYPE x509_cert_expired gauge
+		x509_cert_expired{common_name="a",filepath="/a.pem",issuer="CA",serial="",source="vault",team="infra"} 0
+		x509_cert_expired{common_name="b",filepath="b.example.com:443",issuer="CA",serial="",source="ingress",team=""} 0
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "x509_cert_expired"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Label names follow the latest publish
+	pub.PublishCerts(certs[1:2:2], nil)
+	expected = `
+		# HELP x509_cert_expired 1 if certificate is expired, 0 otherwise
+		# TYPE x509_cert_expired gauge
+		x509_cert_expired{common_name="b",filepath="b.example.com:443",issuer="CA",serial="",source="ingress"} 0
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "x509_cert_expired"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishCerts_CertInfo(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	pub, err := NewRegistryPublisher(reg, fixedClock(now))
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+
+	// Same CN in one bundle, told apart by their serial
+	leaf := certloader.CertInfo{
+		FilePath: "/bundle.pem", CommonName: "a", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+		SANs: []string{"a.example.com", "10.0.0.1"}, SerialNumber: "1f", Fingerprint: "aa11",
+		KeyAlgorithm: "RSA", KeySize: 2048, SignatureAlgorithm: "SHA256-RSA",
+		KeyUsages: []string{"digital_signature", "key_encipherment"}, ExtKeyUsages: []string{"server_auth"},
+	}
+	renewed := leaf
+	renewed.SerialNumber, renewed.Fingerprint = "20", "bb22"
+	renewed.KeyAlgorithm, renewed.KeySize, renewed.SignatureAlgorithm = "ECDSA", 256, "ECDSA-SHA256"
+	ca := certloader.CertInfo{FilePath: "/bundle.pem", CommonName: "CA", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+		SerialNumber: "1", Fingerprint: "cc33", IsCA: true, KeyUsages: []string{"cert_sign"}}
+	pub.PublishCerts([]*certloader.CertInfo{&leaf, &renewed, &ca}, nil)
+
+	expected := `
+		# HELP x509_cert_info Always 1, carries the certificate metadata as labels
+		# TYPE x509_cert_info gauge
+		x509_cert_info{common_name="CA",ext_key_usage="",filepath="/bundle.pem",fingerprint_sha256="cc33",is_ca="true",issuer="CA",key_algorithm="",key_size="",key_usage="cert_sign",sans="",serial="1",signature_algorithm=""} 1
+		x509_cert_info{common_name="a",ext_key_usage="server_auth",filepath="/bundle.pem",fingerprint_sha256="aa11",is_ca="false",issuer="CA",key_algorithm="RSA",key_size="2048",key_usage="digital_signature,key_encipherment",sans="a.example.com,10.0.0.1",serial="1f",signature_algorithm="SHA256-RSA"} 1
+		x509_cert_info{common_name="a",ext_key_usage="server_auth",filepath="/bundle.pem",fingerprint_sha256="bb22",is_ca="false",issuer="CA",key_algorithm="ECDSA",key_size="256",key_usage="digital_signature,key_encipherment",sans="a.example.com,10.0.0.1",serial="20",signature_algorithm="ECDSA-SHA256"} 1
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "x509_cert_info"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishCerts_SameCommonName(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	pub, err := NewRegistryPublisher(reg, fixedClock(now))
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+
+	// A renewal appended to the bundle of the cert it replaces
+	old := &certloader.CertInfo{FilePath: "/bundle.pem", CommonName: "a", Issuer: "CA", SerialNumber: "1f",
+		NotBefore: now.Add(-24 * time.Hour), NotAfter: now.Add(24 * time.Hour)}
+	renewed := &certloader.CertInfo{FilePath: "/bundle.pem", CommonName: "a", Issuer: "CA", SerialNumber: "20",
+		NotBefore: now, NotAfter: now.Add(48 * time.Hour)}
+	vault := &certloader.CertInfo{FilePath: "pki/cert/21", CommonName: "a", Issuer: "CA", SerialNumber: "21",
+		NotBefore: now, NotAfter: now.Add(72 * time.Hour), Labels: map[string]string{"serial": "21"}}
+	pub.PublishCerts([]*certloader.CertInfo{old, renewed, vault}, nil)
+
+	expected := `
+		# HELP x509_cert_not_after Certificate expiry time (unix seconds)
+		# TYPE x509_cert_not_after gauge
+		x509_cert_not_after{common_name="a",filepath="/bundle.pem",issuer="CA",serial="1f"} 1.7488224e+09
+		x509_cert_not_after{common_name="a",filepath="/bundle.pem",issuer="CA",serial="20"} 1.7489088e+09
+		x509_cert_not_after{common_name="a",filepath="pki/cert/21",issuer="CA",serial="21"} 1.7489952e+09
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "x509_cert_not_after"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishCerts_CountsCertOncePerFile(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	pub, err := NewRegistryPublisher(reg, fixedClock(now))
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+
+	// A kubeconfig CA emitted for each of its two contexts, and the same CA
+	// in a file of its own
+	ca := func(path, context string) *certloader.CertInfo {
+		return &certloader.CertInfo{FilePath: path, CommonName: "CA", Issuer: "CA", SerialNumber: "1", Fingerprint: "ab",
+			NotBefore: now, NotAfter: now.Add(48 * time.Hour), Labels: map[string]string{"context": context}}
+	}
+	pub.PublishCerts([]*certloader.CertInfo{ca("/kubeconfig", "dev"), ca("/kubeconfig", "prod"), ca("/ca.pem", "")}, nil)
+
+	expected := `
+		# HELP x509_cert_expired 1 if certificate is expired, 0 otherwise
+		# TYPE x509_cert_expired gauge
+		x509_cert_expired{common_name="CA",context="",filepath="/ca.pem",issuer="CA",serial="1"} 0
+		x509_cert_expired{common_name="CA",context="dev",filepath="/kubeconfig",issuer="CA",serial="1"} 0
+		x509_cert_expired{common_name="CA",context="prod",filepath="/kubeconfig",issuer="CA",serial="1"} 0
+		# HELP x509_valid_certs_total Number of certificates within their validity period (neither expired nor not yet valid)
+		# TYPE x509_valid_certs_total gauge
+		x509_valid_certs_total 2
+		# HELP x509_certs_by_expiry_bucket Number of certificates grouped by expiry time range
+		# TYPE x509_certs_by_expiry_bucket gauge
+		x509_certs_by_expiry_bucket{range="<1d"} 0
+		x509_certs_by_expiry_bucket{range="<30d"} 0
+		x509_certs_by_expiry_bucket{range="<7d"} 2
+		x509_certs_by_expiry_bucket{range="<90d"} 0
+		x509_certs_by_expiry_bucket{range=">=90d"} 0
+		x509_certs_by_expiry_bucket{range="expired"} 0
+		x509_certs_by_expiry_bucket{range="not_yet_valid"} 0
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"x509_cert_expired", "x509_valid_certs_total", "x509_certs_by_expiry_bucket"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishCerts_LoaderSerialLabel(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	pub, err := NewRegistryPublisher(reg, fixedClock(now))
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+
+	// A loader label named like an x509_cert_info one is carried once
+	c := &certloader.CertInfo{FilePath: "pki/cert/1f", CommonName: "a", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+		SerialNumber: "1f", Labels: map[string]string{"mount": "pki", "serial": "1f"}}
+	pub.PublishCerts([]*certloader.CertInfo{c}, nil)
+
+	expected := `
+		# HELP x509_cert_expired 1 if certificate is expired, 0 otherwise
+		# TYPE x509_cert_expired gauge
+		x509_cert_expired{common_name="a",filepath="pki/cert/1f",issuer="CA",mount="pki",serial="1f"} 0
+		# HELP x509_cert_info Always 1, carries the certificate metadata as labels
+		# TYPE x509_cert_info gauge
+		x509_cert_info{common_name="a",ext_key_usage="",filepath="pki/cert/1f",fingerprint_sha256="",is_ca="false",issuer="CA",key_algorithm="",key_size="",key_usage="",mount="pki",sans="",serial="1f",signature_algorithm=""} 1
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "x509_cert_expired", "x509_cert_info"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishCerts_ChainValid(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	pub, err := NewRegistryPublisher(reg, fixedClock(now))
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+
+	pub.PublishCerts([]*certloader.CertInfo{
+		{FilePath: "/a.pem", CommonName: "a", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+			Chain: &certloader.ChainStatus{Valid: true}},
+		{FilePath: "/a.pem", CommonName: "CA", Issuer: "Root", NotBefore: now, NotAfter: now.Add(time.Hour)},
+		{FilePath: "/b.pem", CommonName: "b", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+			Chain: &certloader.ChainStatus{Reason: certloader.ChainMissingIntermediate}, Labels: map[string]string{"source": "x"}},
+	}, nil)
+
+	expected := `
+		# HELP x509_cert_chain_valid 1 if the bundle of this leaf chains to a trusted root, 0 otherwise (see reason)
+		# TYPE x509_cert_chain_valid gauge
+		x509_cert_chain_valid{common_name="a",filepath="/a.pem",issuer="CA",reason="",serial="",source=""} 1
+		x509_cert_chain_valid{common_name="b",filepath="/b.pem",issuer="CA",reason="missing_intermediate",serial="",source="x"} 0
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "x509_cert_chain_valid"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishCerts_KeyMatch(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	pub, err := NewRegistryPublisher(reg, fixedClock(now))
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+
+	pub.PublishCerts([]*certloader.CertInfo{
+		{FilePath: "/a.crt", CommonName: "a", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+			Key: &certloader.KeyStatus{Match: true, KeyPath: "/a.key"}},
+		{FilePath: "/a.crt", CommonName: "CA", Issuer: "Root", NotBefore: now, NotAfter: now.Add(time.Hour)},
+		{FilePath: "/b.crt", CommonName: "b", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+			Key: &certloader.KeyStatus{Reason: certloader.KeyMismatch, KeyPath: "/b.key"}},
+		{FilePath: "/c.crt", CommonName: "c", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+			Key: &certloader.KeyStatus{Reason: certloader.KeyMissing}},
+	}, nil)
+
+	expected := `
+		# HELP x509_cert_key_match 1 if a private key of the source matches the certificate, 0 otherwise (see reason)
+		# TYPE x509_cert_key_match gauge
+		x509_cert_key_match{common_name="a",filepath="/a.crt",issuer="CA",key_file="/a.key",reason="",serial=""} 1
+		x509_cert_key_match{common_name="b",filepath="/b.crt",issuer="CA",key_file="/b.key",reason="mismatch",serial=""} 0
+		x509_cert_key_match{common_name="c",filepath="/c.crt",issuer="CA",key_file="",reason="missing",serial=""} 0
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "x509_cert_key_match"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishCerts_PolicyViolation(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	pub, err := NewRegistryPublisher(reg, fixedClock(now))
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+
+	pub.PublishCerts([]*certloader.CertInfo{
+		{FilePath: "/a.pem", CommonName: "a", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+			Violations: []string{certloader.RuleWeakSignature, certloader.RuleRSAKeySize}},
+		{FilePath: "/b.pem", CommonName: "b", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour)},
+	}, nil)
+
+	expected := `
+		# HELP x509_cert_policy_violation 1 for every policy rule the certificate breaks (weak signature, key size, validity period)
+		# TYPE x509_cert_policy_violation gauge
+		x509_cert_policy_violation{common_name="a",filepath="/a.pem",issuer="CA",rule="rsa_key_size",serial=""} 1
+		x509_cert_policy_violation{common_name="a",filepath="/a.pem",issuer="CA",rule="weak_signature",serial=""} 1
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "x509_cert_policy_violation"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishCerts_Lifetime(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	pub, err := NewRegistryPublisher(reg, fixedClock(now))
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+
+	pub.PublishCerts([]*certloader.CertInfo{
+		// Vault agent 24h cert, 6h left
+		{FilePath: "/agent.pem", CommonName: "agent", Issuer: "CA", NotBefore: now.Add(-18 * time.Hour), NotAfter: now.Add(6 * time.Hour)},
+		// Two years cert, one year left
+		{FilePath: "/web.pem", CommonName: "web", Issuer: "CA", NotBefore: now.Add(-365 * 24 * time.Hour), NotAfter: now.Add(365 * 24 * time.Hour)},
+		{FilePath: "/future.pem", CommonName: "future", Issuer: "CA", NotBefore: now.Add(time.Hour), NotAfter: now.Add(2 * time.Hour)},
+		{FilePath: "/empty.pem", CommonName: "empty", Issuer: "CA", NotBefore: now, NotAfter: now},
+	}, nil)
+
+	expected := `
+		# HELP x509_cert_lifetime_consumed_ratio Fraction of the certificate validity period elapsed, from 0 at not_before to 1 at not_after
+		# TYPE x509_cert_lifetime_consumed_ratio gauge
+		x509_cert_lifetime_consumed_ratio{common_name="agent",filepath="/agent.pem",issuer="CA",serial=""} 0.75
+		x509_cert_lifetime_consumed_ratio{common_name="future",filepath="/future.pem",issuer="CA",serial=""} 0
+		x509_cert_lifetime_consumed_ratio{common_name="web",filepath="/web.pem",issuer="CA",serial=""} 0.5
+		# HELP x509_cert_lifetime_seconds Length of the certificate validity period (seconds)
+		# TYPE x509_cert_lifetime_seconds gauge
+		x509_cert_lifetime_seconds{common_name="agent",filepath="/agent.pem",issuer="CA",serial=""} 86400
+		x509_cert_lifetime_seconds{common_name="empty",filepath="/empty.pem",issuer="CA",serial=""} 0
+		x509_cert_lifetime_seconds{common_name="future",filepath="/future.pem",issuer="CA",serial=""} 3600
+		x509_cert_lifetime_seconds{common_name="web",filepath="/web.pem",issuer="CA",serial=""} 6.3072e+07
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"x509_cert_lifetime_seconds", "x509_cert_lifetime_consumed_ratio"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishRules(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	pub, err := NewRegistryPublisher(reg, fixedClock(now))
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+
+	pub.PublishCerts([]*certloader.CertInfo{
+		{FilePath: "/a.pem", CommonName: "a", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+			FailedRules: []string{"corp_sans"}},
+		{FilePath: "/b.pem", CommonName: "b", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour)},
+	}, nil)
+	pub.PublishRules([]rules.Result{
+		{Rule: "corp_sans", Checked: 2, Failed: 1},
+		{Rule: "team_label", Checked: 2, Errors: 2},
+	})
+
+	expected := `
+		# HELP x509_cert_rule_failed 1 for every user-defined rule the certificate fails
+		# TYPE x509_cert_rule_failed gauge
+		x509_cert_rule_failed{common_name="a",filepath="/a.pem",issuer="CA",rule="corp_sans",serial=""} 1
+		# HELP x509_rule_checked_certs Number of certificates a user-defined rule applied to in the last evaluation
+		# TYPE x509_rule_checked_certs gauge
+		x509_rule_checked_certs{rule="corp_sans"} 2
+		x509_rule_checked_certs{rule="team_label"} 2
+		# HELP x509_rule_evaluation_errors Number of certificates a user-defined rule could not be evaluated on in the last evaluation
+		# TYPE x509_rule_evaluation_errors gauge
+		x509_rule_evaluation_errors{rule="corp_sans"} 0
+		x509_rule_evaluation_errors{rule="team_label"} 2
+		# HELP x509_rule_failed_certs Number of certificates failing a user-defined rule in the last evaluation
+		# TYPE x509_rule_failed_certs gauge
+		x509_rule_failed_certs{rule="corp_sans"} 1
+		x509_rule_failed_certs{rule="team_label"} 0
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "x509_cert_rule_failed",
+		"x509_rule_checked_certs", "x509_rule_failed_certs", "x509_rule_evaluation_errors"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rules removed from the config disappear
+	pub.PublishRules(nil)
+	if n, err := testutil.GatherAndCount(reg, "x509_rule_checked_certs"); err != nil || n != 0 {
+		t.Errorf("expected no series, got %d (%v)", n, err)
+	}
+}
+
+func TestPublishCerts_Revocation(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	pub, err := NewRegistryPublisher(reg, fixedClock(now))
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+
+	pub.PublishCerts([]*certloader.CertInfo{
+		{FilePath: "/a.pem", CommonName: "a", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+			Revocation: &certloader.RevocationStatus{Checked: true, Revoked: true, Method: certloader.RevocationCRL,
+				Errors: map[string]int{certloader.RevocationOCSP: 2}}},
+		{FilePath: "/b.pem", CommonName: "b", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+			Revocation: &certloader.RevocationStatus{Checked: true, Method: certloader.RevocationOCSP}},
+		{FilePath: "/c.pem", CommonName: "c", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour),
+			Revocation: &certloader.RevocationStatus{Errors: map[string]int{certloader.RevocationCRL: 1}}},
+		{FilePath: "/d.pem", CommonName: "d", Issuer: "CA", NotBefore: now, NotAfter: now.Add(time.Hour)},
+	}, nil)
+
+	expected := `
+		# HELP x509_cert_revocation_check_errors Number of OCSP responders or CRL distribution points that failed in the last check
+		# TYPE x509_cert_revocation_check_errors gauge
+		x509_cert_revocation_check_errors{common_name="a",filepath="/a.pem",issuer="CA",method="ocsp",serial=""} 2
+		x509_cert_revocation_check_errors{common_name="c",filepath="/c.pem",issuer="CA",method="crl",serial=""} 1
+		# HELP x509_cert_revoked 1 if the certificate is revoked according to OCSP or its CRL, 0 otherwise
+		# TYPE x509_cert_revoked gauge
+		x509_cert_revoked{common_name="a",filepath="/a.pem",issuer="CA",method="crl",serial=""} 1
+		x509_cert_revoked{common_name="b",filepath="/b.pem",issuer="CA",method="ocsp",serial=""} 0
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"x509_cert_revoked", "x509_cert_revocation_check_errors"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishCRLs(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	pub, err := NewRegistryPublisher(reg, fixedClock(now))
+	if err != nil {
+		t.Fatalf("NewRegistryPublisher: %v", err)
+	}
+
+	pub.PublishCRLs([]*certloader.CRLInfo{
+		{FilePath: "/pki/ca.crl", Issuer: "Test CA", ThisUpdate: now, NextUpdate: now.Add(time.Hour), RevokedCount: 3,
+			Labels: map[string]string{"source": "pki"}},
+		{FilePath: "/pki/old.crl", Issuer: "Old CA", ThisUpdate: now, RevokedCount: 0},
+	})
+
+	expected := `
+		# HELP x509_crl_next_update Time by which the next CRL is due (unix seconds), clients reject the CRL after it
+		# TYPE x509_crl_next_update gauge
+		x509_crl_next_update{filepath="/pki/ca.crl",issuer="Test CA",source="pki"} 1.7487396e+09
+		# HELP x509_crl_revoked_entries Number of revoked certificates listed in the CRL
+		# TYPE x509_crl_revoked_entries gauge
+		x509_crl_revoked_entries{filepath="/pki/ca.crl",issuer="Test CA",source="pki"} 3
+		x509_crl_revoked_entries{filepath="/pki/old.crl",issuer="Old CA",source=""} 0
+		# HELP x509_crl_this_update CRL issue time (unix seconds)
+		# TYPE x509_crl_this_update gauge
+		x509_crl_this_update{filepath="/pki/ca.crl",issuer="Test CA",source="pki"} 1.748736e+09
+		x509_crl_this_update{filepath="/pki/old.crl",issuer="Old CA",source=""} 1.748736e+09
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"x509_crl_this_update", "x509_crl_next_update", "x509_crl_revoked_entries"); err != nil {
+		t.Fatal(err)
+	}
+
+	pub.PublishCRLs(nil)
+	if count, _ := testutil.GatherAndCount(reg, "x509_crl_this_update"); count != 0 {
+		t.Errorf("expected CRL series to be dropped, got %d", count)
+	}
+}
+
+func TestSetConfigReload(t *testing.T) {
+	at := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	SetConfigReload(true, at)
+	if got := testutil.ToFloat64(configLastReloadSuccessful); got != 1 {
+		t.Fatalf("expected reload successful=1, got %f", got)
+	}
+	if got := testutil.ToFloat64(configLastReloadSuccessTimestamp); got != float64(at.Unix()) {
+		t.Fatalf("expected success timestamp=%d, got %f", at.Unix(), got)
+	}
+
+	// A failed reload keeps the last success timestamp
+	SetConfigReload(false, at.Add(time.Hour))
+	if got := testutil.ToFloat64(configLastReloadSuccessful); got != 0 {
+		t.Fatalf("expected reload successful=0, got %f", got)
+	}
+	if got := testutil.ToFloat64(configLastReloadSuccessTimestamp); got != float64(at.Unix()) {
+		t.Fatalf("expected success timestamp unchanged, got %f", got)
+	}
+}
+
+func TestScanCacheCollectors(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	stats := certloader.CacheStats{Hits: 7, Misses: 3, Entries: 5}
+	reg.MustRegister(scanCacheCollectors(func() certloader.CacheStats { return stats })...)
+
+	expected := `
+# HELP x509_scan_cache_hits_total Files whose previous parse result was reused (same mtime, size and inode)
+# TYPE x509_scan_cache_hits_total counter
+x509_scan_cache_hits_total 7
+# HELP x509_scan_cache_misses_total Files parsed because they were new or changed since the last scan
+# TYPE x509_scan_cache_misses_total counter
+x509_scan_cache_misses_total 3
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"x509_scan_cache_hits_total", "x509_scan_cache_misses_total"); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+
+	stats.Entries = 9
+	if got := testutil.ToFloat64(scanCacheCollectors(func() certloader.CacheStats { return stats })[2]); got != 9 {
+		t.Errorf("expected 9 entries, got %v", got)
+	}
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"x509-watch/internal/certloader"
+)
+
+// RegisterScanCache exposes the hit/miss counters of the scan cache on the
+// global registry. stats is read at scrape time.
+func RegisterScanCache(stats func() certloader.CacheStats) {
+	prometheus.MustRegister(scanCacheCollectors(stats)...)
+}
+
+func scanCacheCollectors(stats func() certloader.CacheStats) []prometheus.Collector {
+	return []prometheus.Collector{
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Name: "x509_scan_cache_hits_total",
+				Help: "Files whose previous parse result was reused (same mtime, size and inode)",
+			},
+			func() float64 { return float64(stats().Hits) },
+		),
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Name: "x509_scan_cache_misses_total",
+				Help: "Files parsed because they were new or changed since the last scan",
+			},
+			func() float64 { return float64(stats().Misses) },
+		),
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "x509_scan_cache_entries",
+				Help: "Number of files currently held in the scan cache",
+			},
+			func() float64 { return float64(stats().Entries) },
+		),
+	}
+}
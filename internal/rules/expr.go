@@ -0,0 +1,152 @@
+package rules
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/ext"
+)
+
+// Expressions are CEL (https://github.com/google/cel-spec) over the fields
+// of the cert variable, declared as "cert.<field>", and now. duration()
+// also accepts a "d" unit for days, and the ext strings library is loaded
+// (lowerAscii, upperAscii, trim...).
+
+// maxCost bounds the work of one evaluation, in CEL cost units (roughly one
+// per operation or list element visited).
+const maxCost = 1_000_000
+
+// fieldTypes are the fields of the cert variable.
+var fieldTypes = map[string]*cel.Type{
+	"common_name":         cel.StringType,
+	"issuer":              cel.StringType,
+	"filepath":            cel.StringType,
+	"source":              cel.StringType,
+	"labels":              cel.MapType(cel.StringType, cel.StringType),
+	"sans":                cel.ListType(cel.StringType),
+	"serial":              cel.StringType,
+	"fingerprint":         cel.StringType,
+	"key_algorithm":       cel.StringType,
+	"key_size":            cel.IntType,
+	"signature_algorithm": cel.StringType,
+	"is_ca":               cel.BoolType,
+	"key_usage":           cel.ListType(cel.StringType),
+	"ext_key_usage":       cel.ListType(cel.StringType),
+	"not_before":          cel.TimestampType,
+	"not_after":           cel.TimestampType,
+	"lifetime":            cel.DurationType,
+	"expires_in":          cel.DurationType,
+	"validity":            cel.StringType,
+	"violations":          cel.ListType(cel.StringType),
+}
+
+var env = newEnv()
+
+func newEnv() *cel.Env {
+	opts := []cel.EnvOption{
+		cel.Variable("now", cel.TimestampType),
+		ext.Strings(),
+		cel.Function("duration", cel.Overload("string_to_duration",
+			[]*cel.Type{cel.StringType}, cel.DurationType, cel.UnaryBinding(duration))),
+		cel.ExtendedValidations(), // bad duration, timestamp and regex literals fail to compile
+	}
+	for _, name := range slices.Sorted(maps.Keys(fieldTypes)) {
+		opts = append(opts, cel.Variable("cert."+name, fieldTypes[name]))
+	}
+	e, err := cel.NewEnv(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// duration replaces the CEL string to duration conversion, see ParseDuration.
+func duration(v ref.Val) ref.Val {
+	s, ok := v.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(v)
+	}
+	d, err := ParseDuration(string(s))
+	if err != nil {
+		return types.NewErr("invalid duration %q: %v", string(s), err)
+	}
+	return types.Duration{Duration: d}
+}
+
+// Expr is a compiled predicate.
+type Expr struct {
+	src string
+	prg cel.Program
+}
+
+func (e *Expr) String() string { return e.src }
+
+// Compile parses and type-checks src, which must evaluate to a bool.
+func Compile(src string) (*Expr, error) {
+	ast, iss := env.Compile(src)
+	if err := iss.Err(); err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", src, err)
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) {
+		return nil, fmt.Errorf("invalid expression %q: evaluates to %s, not bool", src, ast.OutputType())
+	}
+	prg, err := env.Program(ast, cel.EvalOptions(cel.OptOptimize), cel.CostLimit(maxCost))
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", src, err)
+	}
+	return &Expr{src: src, prg: prg}, nil
+}
+
+// EvalBool evaluates the predicate with vars, keyed like the declarations
+// ("now", "cert.issuer"...).
+func (e *Expr) EvalBool(vars map[string]any) (bool, error) {
+	v, _, err := e.prg.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a bool, got %s", v.Type())
+	}
+	return b, nil
+}
+
+// ParseDuration is time.ParseDuration plus a leading "d" unit for days, e.g.
+// "90d" or "1d12h".
+func ParseDuration(s string) (time.Duration, error) {
+	if i := strings.IndexByte(s, 'd'); i > 0 {
+		days, err := strconv.Atoi(s[:i])
+		if err == nil {
+			rest := time.Duration(0)
+			if s[i+1:] != "" {
+				if rest, err = time.ParseDuration(s[i+1:]); err != nil {
+					return 0, err
+				}
+			}
+			return time.Duration(days)*24*time.Hour + rest, nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// sortedMap is a string map whose macros (all, exists, filter, map...) see
+// the keys in order, so that their results are stable.
+type sortedMap struct {
+	traits.Mapper
+	keys traits.Iterable
+}
+
+func newSortedMap(m map[string]string) ref.Val {
+	keys := types.NewStringList(types.DefaultTypeAdapter, slices.Sorted(maps.Keys(m)))
+	return sortedMap{Mapper: types.NewStringStringMap(types.DefaultTypeAdapter, m).(traits.Mapper), keys: keys.(traits.Iterable)}
+}
+
+func (m sortedMap) Iterator() traits.Iterator { return m.keys.Iterator() }
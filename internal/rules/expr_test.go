@@ -0,0 +1,154 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"x509-watch/internal/certloader"
+)
+
+var testNow = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func testVars() map[string]any {
+	return certVars(&certloader.CertInfo{
+		CommonName: "api.corp.example",
+		SANs:       []string{"api.corp.example", "*.api.corp.example"},
+		KeySize:    2048,
+		NotBefore:  testNow.Add(-24 * time.Hour),
+		NotAfter:   testNow.Add(89 * 24 * time.Hour),
+		Labels:     map[string]string{"env": "prod", "tier": "web", "team": "infra"},
+	}, testNow)
+}
+
+func TestExpr_EvalBool(t *testing.T) {
+	vars := testVars()
+	tests := map[string]bool{
+		`1 + 2 * 3 == 7 && 7 % 3 == 1`:                                      true,
+		`!true || false`:                                                    false,
+		`false && 1 / 0 == 1`:                                               false, // short-circuit
+		`(cert.key_size >= 2048 ? "ok" : "weak") == "ok"`:                   true,
+		`cert.common_name.endsWith(".corp.example")`:                        true,
+		`cert.common_name.matches("^[a-z]+\\.corp\\.")`:                     true,
+		`cert.common_name.startsWith("www")`:                                false,
+		`cert.common_name.upperAscii().contains("CORP")`:                    true,
+		`size(cert.sans) == 2 && cert.sans.size() == 2`:                     true,
+		`cert.sans[1] == "*.api.corp.example"`:                              true,
+		`"api.corp.example" in cert.sans`:                                   true,
+		`"env" in cert.labels && cert.labels.env == "prod"`:                 true,
+		`has(cert.labels.owner)`:                                            false,
+		`cert.sans.all(s, s.endsWith(".corp.example"))`:                     true,
+		`cert.sans.exists_one(s, s.contains("api"))`:                        false,
+		`cert.sans.map(s, size(s)) == [16, 18]`:                             true,
+		`cert.labels.map(k, k) == ["env", "team", "tier"]`:                  true, // keys in order
+		`cert.labels.filter(k, k != "team") == ["env", "tier"]`:             true,
+		`cert.not_after - cert.not_before == duration("90d")`:               true,
+		`cert.not_after - now < duration("720h")`:                           false,
+		`cert.not_before + duration("1d") == now`:                           true,
+		`now > timestamp("2029-12-31T00:00:00Z")`:                           true,
+		`duration("1d12h") == duration("36h")`:                              true,
+		`string(cert.key_size) + "-bit" == "2048-bit"`:                      true,
+		`cert.is_ca == false && cert.violations == [] && cert.issuer == ""`: true,
+	}
+	for src, want := range tests {
+		e, err := Compile(src)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		got, err := e.EvalBool(vars)
+		if err != nil || got != want {
+			t.Errorf("%s: expected %v, got %v (%v)", src, want, got, err)
+		}
+	}
+}
+
+func TestExpr_EvalErrors(t *testing.T) {
+	vars := testVars()
+	tests := map[string]string{
+		`cert.labels.owner == "x"`: "no such key",
+		`cert.sans[2] == ""`:       "index out of bounds",
+		`1 / 0 == 1`:               "division by zero",
+		`cert.common_name.matches(cert.common_name + "[")`: "missing closing ]", // patterns built at run time
+		`duration(cert.common_name) > duration("1h")`:      "invalid duration",
+		`[0,1,2,3,4,5,6,7,8,9].all(a, [0,1,2,3,4,5,6,7,8,9].all(b, [0,1,2,3,4,5,6,7,8,9].all(c, [0,1,2,3,4,5,6,7,8,9].all(d, [0,1,2,3,4,5,6,7,8,9].all(e, [0,1,2,3,4,5,6,7,8,9].all(f, a+b+c+d+e+f >= 0))))))`: "cost limit",
+	}
+	for src, want := range tests {
+		e, err := Compile(src)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if _, err := e.EvalBool(vars); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected an error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := map[string]string{
+		`cert.issuer ==`:                   "Syntax error",
+		`cert.issuer == "a`:                "Syntax error",
+		`subject == "a"`:                   "undeclared reference to 'subject'",
+		`cert.subject == "a"`:              "undeclared reference to 'cert'",
+		`lower(cert.issuer) == ""`:         "undeclared reference to 'lower'",
+		`cert.issuer + 1 == ""`:            "found no matching overload",
+		`cert.sans.exists(s)`:              "exists",
+		`has(cert)`:                        "invalid argument to has() macro",
+		`cert.issuer.matches("[")`:         "invalid matches argument",
+		`duration("ten days") > now - now`: "invalid duration",
+		`cert.sans.all(s, s == x)`:         "undeclared reference to 'x'",
+		`cert.issuer`:                      "evaluates to string, not bool",
+		`cert.sans.map(a, a)`:              "evaluates to list(string), not bool",
+	}
+	for src, want := range tests {
+		_, err := Compile(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected an error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"90d":    90 * 24 * time.Hour,
+		"1d12h":  36 * time.Hour,
+		"36h":    36 * time.Hour,
+		"1h30m":  90 * time.Minute,
+		"0d":     0,
+		"500ms":  500 * time.Millisecond,
+		"2d1h1s": 49*time.Hour + time.Second,
+	}
+	for s, want := range tests {
+		got, err := ParseDuration(s)
+		if err != nil || got != want {
+			t.Errorf("%s: expected %s, got %s (%v)", s, want, got, err)
+		}
+	}
+	for _, s := range []string{"", "d", "1dx", "ten days"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+func FuzzCompileEval(f *testing.F) {
+	for _, src := range []string{
+		`cert.lifetime <= duration("90d")`,
+		`cert.sans.all(s, s.endsWith(".corp.example"))`,
+		`has(cert.labels.team) && cert.labels.team.matches("^[a-z]+$")`,
+		`cert.labels.exists(k, k.startsWith("e")) || cert.key_size > 1024`,
+		`now - cert.not_before > duration("1d12h") ? cert.is_ca : size(cert.violations) == 0`,
+		`[1, 2, 3].map(x, x * 2).filter(x, x > 2) == [4, 6]`,
+	} {
+		f.Add(src)
+	}
+	vars := testVars()
+	f.Fuzz(func(t *testing.T, src string) {
+		e, err := Compile(src)
+		if err != nil {
+			return
+		}
+		_, _ = e.EvalBool(vars)
+	})
+}
@@ -0,0 +1,167 @@
+// Package rules evaluates user-defined policy rules, written as CEL
+// expressions over certificate fields, against the certificates of a scan.
+package rules
+
+import (
+	"errors"
+	"time"
+
+	"x509-watch/internal/certloader"
+)
+
+// Rule is a named assertion on certificates: every certificate matching When
+// must satisfy Expr.
+type Rule struct {
+	Name        string
+	Description string
+	When        *Expr // nil matches every certificate
+	Expr        *Expr
+}
+
+// New compiles a rule. when may be empty.
+func New(name, description, when, expr string) (*Rule, error) {
+	if expr == "" {
+		return nil, errors.New("expr is required")
+	}
+	r := &Rule{Name: name, Description: description}
+	var err error
+	if when != "" {
+		if r.When, err = Compile(when); err != nil {
+			return nil, err
+		}
+	}
+	if r.Expr, err = Compile(expr); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Result is the outcome of one rule over a scan. Certificates the rule could
+// not be evaluated on (e.g. a missing label) count as errors, not failures.
+type Result struct {
+	Rule        string    `json:"rule"`
+	Description string    `json:"description,omitempty"`
+	When        string    `json:"when,omitempty"`
+	Expr        string    `json:"expr"`
+	Checked     int       `json:"checked"` // certificates matching When
+	Failed      int       `json:"failed"`
+	Errors      int       `json:"errors"`
+	Failures    []Failure `json:"failures"`
+}
+
+// Failure is a certificate failing a rule, or one it could not be evaluated on.
+type Failure struct {
+	CommonName string            `json:"common_name"`
+	Issuer     string            `json:"issuer"`
+	FilePath   string            `json:"filepath"`
+	Serial     string            `json:"serial"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Evaluate checks every rule against certs at now, sets FailedRules on every
+// cert, replacing what an earlier evaluation found, and returns one result
+// per rule in order.
+func Evaluate(rules []*Rule, certs []*certloader.CertInfo, now time.Time) []Result {
+	results := make([]Result, len(rules))
+	for i, r := range rules {
+		results[i] = Result{Rule: r.Name, Description: r.Description, Expr: r.Expr.String(), Failures: []Failure{}}
+		if r.When != nil {
+			results[i].When = r.When.String()
+		}
+	}
+
+	for _, c := range certs {
+		c.FailedRules = nil
+		vars := certVars(c, now)
+		for i, r := range rules {
+			res := &results[i]
+			ok, err := r.check(vars)
+			switch {
+			case err != nil:
+				res.Errors++
+				res.Failures = append(res.Failures, newFailure(c, err))
+			case ok == nil:
+				continue
+			case !*ok:
+				res.Failed++
+				res.Failures = append(res.Failures, newFailure(c, nil))
+				c.FailedRules = append(c.FailedRules, r.Name)
+			}
+			res.Checked++
+		}
+	}
+	return results
+}
+
+// check returns nil when the certificate does not match When, whether it
+// satisfies Expr otherwise.
+func (r *Rule) check(vars map[string]any) (*bool, error) {
+	if r.When != nil {
+		match, err := r.When.EvalBool(vars)
+		if err != nil || !match {
+			return nil, err
+		}
+	}
+	ok, err := r.Expr.EvalBool(vars)
+	return &ok, err
+}
+
+func newFailure(c *certloader.CertInfo, err error) Failure {
+	f := Failure{
+		CommonName: c.CommonName,
+		Issuer:     c.Issuer,
+		FilePath:   c.FilePath,
+		Serial:     c.SerialNumber,
+		Labels:     c.Labels,
+	}
+	if err != nil {
+		f.Error = err.Error()
+	}
+	return f
+}
+
+// certVars returns the variables of c, see fieldTypes.
+func certVars(c *certloader.CertInfo, now time.Time) map[string]any {
+	labels := c.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	fields := map[string]any{
+		"common_name":         c.CommonName,
+		"issuer":              c.Issuer,
+		"filepath":            c.FilePath,
+		"source":              c.Labels["source"],
+		"labels":              newSortedMap(labels),
+		"sans":                list(c.SANs),
+		"serial":              c.SerialNumber,
+		"fingerprint":         c.Fingerprint,
+		"key_algorithm":       c.KeyAlgorithm,
+		"key_size":            int64(c.KeySize),
+		"signature_algorithm": c.SignatureAlgorithm,
+		"is_ca":               c.IsCA,
+		"key_usage":           list(c.KeyUsages),
+		"ext_key_usage":       list(c.ExtKeyUsages),
+		"not_before":          c.NotBefore,
+		"not_after":           c.NotAfter,
+		"lifetime":            c.NotAfter.Sub(c.NotBefore),
+		"expires_in":          c.NotAfter.Sub(now),
+		"validity":            string(c.ValidityState(now)),
+		"violations":          list(c.Violations),
+	}
+
+	vars := make(map[string]any, len(fields)+1)
+	for name, v := range fields {
+		vars["cert."+name] = v
+	}
+	vars["now"] = now
+	return vars
+}
+
+// list returns s, never nil: a nil slice would be a CEL null.
+func list(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
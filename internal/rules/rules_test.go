@@ -0,0 +1,87 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"x509-watch/internal/certloader"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := func(cn, issuer, path string, days int, sans ...string) *certloader.CertInfo {
+		return &certloader.CertInfo{
+			CommonName: cn, Issuer: issuer, FilePath: path, SANs: sans, SerialNumber: "1",
+			NotBefore: now, NotAfter: now.Add(time.Duration(days) * 24 * time.Hour),
+			Labels: map[string]string{"source": "local"},
+		}
+	}
+	certs := []*certloader.CertInfo{
+		cert("api", "Corp Internal CA", "/etc/prod/api.pem", 90, "api.corp.example"),
+		cert("db", "Corp Internal CA", "/etc/prod/db.pem", 365, "db.corp.example"),
+		cert("web", "Public CA", "/etc/prod/web.pem", 90, "*.example.com"),
+		cert("dev", "Public CA", "/etc/dev/dev.pem", 90, "*.dev.corp.example"),
+	}
+	certs[3].FailedRules = []string{"stale"}
+
+	mustRule := func(name, when, expr string) *Rule {
+		r, err := New(name, "", when, expr)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return r
+	}
+	rules := []*Rule{
+		mustRule("internal_short_lived", `cert.issuer == "Corp Internal CA"`, `cert.lifetime <= duration("90d")`),
+		mustRule("corp_sans", "", `cert.sans.all(s, s.endsWith(".corp.example"))`),
+		mustRule("no_prod_wildcards", `cert.filepath.startsWith("/etc/prod/")`, `!cert.sans.exists(s, s.startsWith("*."))`),
+		mustRule("team_label", "", `cert.labels.team != ""`),
+	}
+
+	results := Evaluate(rules, certs, now)
+
+	summary := make([]string, 0, len(results))
+	for _, r := range results {
+		var failed []string
+		for _, f := range r.Failures {
+			if f.Error == "" {
+				failed = append(failed, f.CommonName)
+			}
+		}
+		summary = append(summary, fmt.Sprintf("%s: checked %d, failed %d %v, errors %d", r.Rule, r.Checked, r.Failed, failed, r.Errors))
+	}
+	want := []string{
+		"internal_short_lived: checked 2, failed 1 [db], errors 0",
+		"corp_sans: checked 4, failed 1 [web], errors 0",
+		"no_prod_wildcards: checked 3, failed 1 [web], errors 0",
+		"team_label: checked 4, failed 0 [], errors 4",
+	}
+	if got := strings.Join(summary, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), got)
+	}
+	if f := results[3].Failures[0]; !strings.Contains(f.Error, "no such key: team") || f.FilePath != "/etc/prod/api.pem" {
+		t.Errorf("unexpected failure %+v", f)
+	}
+
+	failed := make([]string, 0, len(certs))
+	for _, c := range certs {
+		failed = append(failed, fmt.Sprintf("%s %v", c.CommonName, c.FailedRules))
+	}
+	if got, want := fmt.Sprint(failed), "[api [] db [internal_short_lived] web [corp_sans no_prod_wildcards] dev []]"; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	if _, err := New("empty", "", "", ""); err == nil {
+		t.Error("expected an error for an empty expr")
+	}
+	if _, err := New("when", "", `cert.subject == "a"`, "true"); err == nil || !strings.Contains(err.Error(), "undeclared reference") {
+		t.Errorf("expected when to be checked, got %v", err)
+	}
+	if _, err := New("ok", "", "", `cert.expires_in > duration("30d") && cert.validity == "valid" && now > cert.not_before`); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}